@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// bikesOptions are the inputs of the bikes command
+type bikesOptions struct {
+	email  string
+	output string
+	sudo   bool
+	clientOptions
+}
+
+// bikesFlags registers the flags of the bikes command on a new flag set
+func bikesFlags(o *bikesOptions) *flag.FlagSet {
+	fs := newFlagSet("bikes", "[flags]", "List the owned and shared bikes on your account.")
+	fs.StringVar(&o.email, "email", "", "VanMoof email address (prompted if empty)")
+	fs.StringVar(&o.output, "output", vanmoof.OutputText, "Output format: 'text' or 'json' (one JSON object per bike)")
+	fs.BoolVar(&o.sudo, "sudo", false, "Skip all validation checks")
+	addClientFlags(fs, &o.clientOptions)
+	return fs
+}
+
+func runBikes(ctx context.Context, args []string) error {
+	var o bikesOptions
+	fs := bikesFlags(&o)
+	fs.Parse(args)
+	if err := o.configOptions.setup(fs); err != nil {
+		return err
+	}
+
+	logger, err := o.newLogger(fs)
+	if err != nil {
+		return err
+	}
+
+	if !vanmoof.IsValidOutputFormat(o.output) {
+		return usageErrorf("invalid output format '%s'. Must be 'text' or 'json'", o.output)
+	}
+
+	client, err := newClient(&o.clientOptions, logger)
+	if err != nil {
+		return err
+	}
+
+	if o.replay != "" && o.email == "" {
+		o.email = replayEmail
+	}
+	emailInput, err := resolveEmail(ctx, o.email, o.sudo)
+	if err != nil {
+		return err
+	}
+
+	bikes, err := client.ListBikesContext(ctx, emailInput, o.noCache)
+	if err != nil {
+		return err
+	}
+
+	if o.output == vanmoof.OutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		for _, bike := range bikes {
+			if err := enc.Encode(struct {
+				vanmoof.BikeData
+				Model     string `json:"model"`
+				Supported bool   `json:"supported"`
+			}{bike, vanmoof.BikeModel(bike), vanmoof.IsSupportedBike(bike)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(bikes) == 0 {
+		fmt.Println("No bikes found")
+		return nil
+	}
+	for _, bike := range bikes {
+		id := "-"
+		if bike.BikeID != 0 {
+			id = fmt.Sprintf("%d", bike.BikeID)
+		}
+		supported := ""
+		if !vanmoof.IsSupportedBike(bike) {
+			supported = " (not supported)"
+		}
+		fmt.Printf("%-8s %-14s %-4s %s%s\n", id, bike.FrameNumber, vanmoof.BikeModel(bike), bike.Name, supported)
+	}
+	return nil
+}
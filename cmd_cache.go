@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// cacheFlags returns the flag set of the cache command
+func cacheFlags() *flag.FlagSet {
+	return newFlagSet("cache", "path|status|logout|purge|rekey", "Inspect and manage the token cache.\n\nSubcommands:\n  path    Print the location of the token cache file\n  status  List the cached accounts and when their tokens expire\n  logout  Remove the cached tokens of one account\n  purge   Delete the token cache with all accounts\n  rekey   Change the encryption key of the token cache")
+}
+
+// cacheOptions are the inputs of the cache subcommands, each of which
+// registers the flags it uses. Only logout and purge talk to the API, to
+// revoke tokens.
+type cacheOptions struct {
+	output    string
+	revoke    bool
+	plaintext bool
+	clientOptions
+}
+
+// addStoreFlags registers the flags locating the token store on fs
+func addStoreFlags(fs *flag.FlagSet, o *cacheOptions) {
+	addConfigFlags(fs, &o.configOptions)
+	addTokenStoreFlag(fs, &o.tokenStore)
+}
+
+// addRevokeFlags registers -revoke and the flags of the API client revoking tokens on fs
+func addRevokeFlags(fs *flag.FlagSet, o *cacheOptions) {
+	fs.BoolVar(&o.revoke, "revoke", false, "Also ask the VanMoof API to invalidate the tokens, using an undocumented endpoint; failures only print a warning")
+	addEndpointFlags(fs, &o.clientOptions)
+}
+
+// newTokenStore returns the token store selected by the flags
+func (o *cacheOptions) newTokenStore(logger *slog.Logger) (vanmoof.TokenStore, error) {
+	paths, err := o.paths()
+	if err != nil {
+		return nil, err
+	}
+	return newTokenStore(o.tokenStore, paths, logger)
+}
+
+func runCache(ctx context.Context, args []string) error {
+	fs := cacheFlags()
+	fs.Parse(args)
+
+	switch fs.Arg(0) {
+	case "path":
+		return cachePath(fs.Args()[1:])
+	case "status":
+		return cacheStatus(ctx, fs.Args()[1:])
+	case "logout":
+		return cacheLogout(ctx, fs.Args()[1:])
+	case "purge":
+		return cachePurge(ctx, fs.Args()[1:])
+	case "rekey":
+		return cacheRekey(ctx, fs.Args()[1:])
+	default:
+		fs.Usage()
+		return usageErrorf("expected subcommand 'path', 'status', 'logout', 'purge' or 'rekey'")
+	}
+}
+
+// cachePath prints the location of the token cache
+func cachePath(args []string) error {
+	var o cacheOptions
+	fs := cachePathFlags(&o)
+	fs.Parse(args)
+	if err := o.configOptions.setup(fs); err != nil {
+		return err
+	}
+
+	store, err := o.newTokenStore(nil)
+	if err != nil {
+		return err
+	}
+	switch store := store.(type) {
+	case *vanmoof.FileTokenStore:
+		fmt.Println(store.Path)
+	case *vanmoof.DirTokenStore:
+		fmt.Println(store.Dir)
+	default:
+		return errors.New("the token store has no path")
+	}
+	return nil
+}
+
+// cacheStatus lists the cached accounts with the expiry of their tokens
+func cacheStatus(ctx context.Context, args []string) error {
+	var o cacheOptions
+	fs := cacheStatusFlags(&o)
+	fs.Parse(args)
+	if err := o.configOptions.setup(fs); err != nil {
+		return err
+	}
+
+	logger, err := o.logOptions.newLogger(fs)
+	if err != nil {
+		return err
+	}
+
+	if !vanmoof.IsValidOutputFormat(o.output) {
+		return usageErrorf("invalid output format '%s'. Must be 'text' or 'json'", o.output)
+	}
+
+	store, err := o.newTokenStore(logger)
+	if err != nil {
+		return err
+	}
+	accounts, err := vanmoof.TokenCacheStatus(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	if o.output == vanmoof.OutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		for _, account := range accounts {
+			if err := enc.Encode(account); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(accounts) == 0 {
+		fmt.Println("No cached tokens")
+		return nil
+	}
+	now := time.Now()
+	for _, account := range accounts {
+		fmt.Println(account.Email)
+		fmt.Printf("  Auth token:    %s\n", describeToken(account.AuthToken, now))
+		fmt.Printf("  App token:     %s\n", describeToken(account.AppToken, now))
+		fmt.Printf("  Refresh token: %s\n", describeToken(account.RefreshToken, now))
+	}
+	return nil
+}
+
+// cacheLogout removes the cached tokens of one account, and optionally revokes them
+func cacheLogout(ctx context.Context, args []string) error {
+	var o cacheOptions
+	fs := cacheLogoutFlags(&o)
+	fs.Parse(args)
+	if err := o.configOptions.setup(fs); err != nil {
+		return err
+	}
+
+	logger, err := o.logOptions.newLogger(fs)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return usageErrorf("expected one email address")
+	}
+	email := fs.Arg(0)
+
+	store, err := o.newTokenStore(logger)
+	if err != nil {
+		return err
+	}
+	tokens, err := vanmoof.RemoveCachedAccount(ctx, store, email)
+	if err != nil {
+		return err
+	}
+	if tokens == nil {
+		return fmt.Errorf("no cached tokens for %s", email)
+	}
+	fmt.Printf("Removed cached tokens for %s\n", email)
+
+	if o.revoke {
+		return revokeTokens(ctx, &o.clientOptions, logger, map[string]vanmoof.CachedTokens{email: *tokens})
+	}
+	return nil
+}
+
+// cachePurge deletes the token cache, and optionally revokes the tokens in it
+func cachePurge(ctx context.Context, args []string) error {
+	var o cacheOptions
+	fs := cachePurgeFlags(&o)
+	fs.Parse(args)
+	if err := o.configOptions.setup(fs); err != nil {
+		return err
+	}
+
+	logger, err := o.logOptions.newLogger(fs)
+	if err != nil {
+		return err
+	}
+
+	store, err := o.newTokenStore(logger)
+	if err != nil {
+		return err
+	}
+	cacheMap, err := vanmoof.PurgeTokenCache(ctx, store)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Token cache deleted")
+
+	if o.revoke {
+		return revokeTokens(ctx, &o.clientOptions, logger, cacheMap)
+	}
+	return nil
+}
+
+// cacheRekey re-encrypts the token cache with a new key
+func cacheRekey(ctx context.Context, args []string) error {
+	var o cacheOptions
+	fs := cacheRekeyFlags(&o)
+	fs.Parse(args)
+	if err := o.configOptions.setup(fs); err != nil {
+		return err
+	}
+
+	logger, err := o.logOptions.newLogger(fs)
+	if err != nil {
+		return err
+	}
+	store, err := o.newTokenStore(logger)
+	if err != nil {
+		return err
+	}
+	fileStore, ok := store.(*vanmoof.FileTokenStore)
+	if !ok {
+		return errors.New("rekey only supports the file token store")
+	}
+
+	var newKey string
+	if !o.plaintext {
+		newKey = os.Getenv("VANMOOF_NEW_CACHE_KEY")
+		if newKey == "" {
+			if newKey, err = vanmoof.ReadPassword(ctx, "Enter new cache key: "); err != nil {
+				return err
+			}
+			confirm, err := vanmoof.ReadPassword(ctx, "Repeat new cache key: ")
+			if err != nil {
+				return err
+			}
+			if confirm != newKey {
+				return errors.New("keys do not match")
+			}
+		}
+		if newKey == "" {
+			return errors.New("new cache key required (use -plaintext to store the cache unencrypted)")
+		}
+	}
+
+	encryption, err := fileStore.Rekey(newKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Token cache rewritten (%s)\n", encryption)
+	if newKey != os.Getenv("VANMOOF_CACHE_KEY") {
+		if newKey == "" {
+			fmt.Println("Unset VANMOOF_CACHE_KEY to use it.")
+		} else {
+			fmt.Println("Set VANMOOF_CACHE_KEY to the new key to use it.")
+		}
+	}
+	return nil
+}
+
+// cachePathFlags registers the flags of 'cache path' on a new flag set
+func cachePathFlags(o *cacheOptions) *flag.FlagSet {
+	fs := newFlagSet("cache path", "[flags]", "Print the location of the token cache file, or directory with -token-store dir:.")
+	addStoreFlags(fs, o)
+	return fs
+}
+
+// cacheStatusFlags registers the flags of 'cache status' on a new flag set
+func cacheStatusFlags(o *cacheOptions) *flag.FlagSet {
+	fs := newFlagSet("cache status", "[flags]", "List the cached accounts and when their auth, app and refresh tokens expire.")
+	fs.StringVar(&o.output, "output", vanmoof.OutputText, "Output format: 'text' or 'json' (one JSON object per account)")
+	addStoreFlags(fs, o)
+	addLogFlags(fs, &o.logOptions)
+	return fs
+}
+
+// cacheLogoutFlags registers the flags of 'cache logout' on a new flag set
+func cacheLogoutFlags(o *cacheOptions) *flag.FlagSet {
+	fs := newFlagSet("cache logout", "[flags] <email>", "Remove the cached tokens of one account, keeping the other accounts.")
+	addRevokeFlags(fs, o)
+	addStoreFlags(fs, o)
+	addLogFlags(fs, &o.logOptions)
+	return fs
+}
+
+// cachePurgeFlags registers the flags of 'cache purge' on a new flag set
+func cachePurgeFlags(o *cacheOptions) *flag.FlagSet {
+	fs := newFlagSet("cache purge", "[flags]", "Delete the token cache with the tokens of all accounts, even if it cannot be decrypted.")
+	addRevokeFlags(fs, o)
+	addStoreFlags(fs, o)
+	addLogFlags(fs, &o.logOptions)
+	return fs
+}
+
+// cacheRekeyFlags registers the flags of 'cache rekey' on a new flag set
+func cacheRekeyFlags(o *cacheOptions) *flag.FlagSet {
+	fs := newFlagSet("cache rekey", "[flags]", "Re-encrypt the token cache with a new key, using Argon2id.\nThe cache is read with $VANMOOF_CACHE_KEY, or as is if it is plaintext. The new key\nis read from $VANMOOF_NEW_CACHE_KEY, or prompted for. Use the same key to only\nupgrade a cache written by an older version.")
+	fs.BoolVar(&o.plaintext, "plaintext", false, "Store the cache unencrypted instead")
+	addStoreFlags(fs, o)
+	addLogFlags(fs, &o.logOptions)
+	return fs
+}
+
+// revokeTokens asks the API to invalidate the tokens of each account. The
+// endpoint is undocumented and the tokens are already gone from the cache,
+// so revocation is best effort: failures are only reported, and only an
+// interruption is returned.
+func revokeTokens(ctx context.Context, o *clientOptions, logger *slog.Logger, cacheMap map[string]vanmoof.CachedTokens) error {
+	client, err := newClient(o, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: tokens not revoked: %v\n", err)
+		return nil
+	}
+
+	for _, email := range slices.Sorted(maps.Keys(cacheMap)) {
+		if err := client.RevokeTokens(ctx, cacheMap[email]); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to revoke tokens for %s, they stay valid until they expire: %v\n", email, err)
+			continue
+		}
+		fmt.Printf("Revoked tokens for %s\n", email)
+	}
+	return ctx.Err()
+}
+
+// describeToken describes whether a cached token is valid and when it expires
+func describeToken(token vanmoof.TokenStatus, now time.Time) string {
+	switch {
+	case !token.Cached:
+		return "not cached"
+	case token.Expiry.IsZero():
+		return "cached (no expiry)"
+	case token.Expiry.After(now):
+		return fmt.Sprintf("valid until %s (in %s)", token.Expiry.Local().Format("2006-01-02 15:04 MST"), humanDuration(token.Expiry.Sub(now)))
+	default:
+		return fmt.Sprintf("expired %s (%s ago)", token.Expiry.Local().Format("2006-01-02 15:04 MST"), humanDuration(now.Sub(token.Expiry)))
+	}
+}
+
+// humanDuration formats d in days, hours and minutes
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+}
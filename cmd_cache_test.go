@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"vanmoof-certificates/internal/fakeapi"
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+func TestCacheLogoutRevoke(t *testing.T) {
+	const email, password = "rider@example.com", "password"
+	isolateEnv(t)
+	server, _, url := startFakeAPI(t, email, password)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name    string
+		fail    bool
+		revoked bool
+	}{
+		{"revoked", false, true},
+		{"revocation fails", true, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.json")
+			store := &vanmoof.FileTokenStore{Path: path}
+			client := fakeapi.NewClient(url)
+			client.Password = password
+			client.TokenStore = store
+			if _, err := client.ListBikesContext(ctx, email, false); err != nil {
+				t.Fatal(err)
+			}
+			tokens, err := store.Load(ctx, email)
+			if err != nil || tokens == nil {
+				t.Fatalf("tokens not cached: %v", err)
+			}
+			if tc.fail {
+				if err := server.Fail(fakeapi.EndpointLogout, fakeapi.ServerError()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// A failed revocation is only a warning
+			args := []string{"logout", "-revoke", "-token-store", "file:" + path, "-api-url", url + "/v8", "-retries", "0", email}
+			if err := runCache(ctx, args); err != nil {
+				t.Fatalf("cache logout: %v", err)
+			}
+			if cached, err := store.Load(ctx, email); err != nil || cached != nil {
+				t.Errorf("tokens still cached: %+v, %v", cached, err)
+			}
+
+			// Revoked tokens are rejected, so only the password would help
+			reuse := fakeapi.NewClient(url)
+			reuse.Password = "wrong"
+			reuse.TokenStore = &vanmoof.MemoryTokenStore{}
+			if err := reuse.TokenStore.Store(ctx, email, *tokens); err != nil {
+				t.Fatal(err)
+			}
+			_, err = reuse.ListBikesContext(ctx, email, false)
+			if revoked := errors.Is(err, vanmoof.ErrUnauthorized); revoked != tc.revoked {
+				t.Errorf("tokens revoked = %v (%v), want %v", revoked, err, tc.revoked)
+			}
+		})
+	}
+}
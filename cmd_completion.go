@@ -0,0 +1,399 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// completeCommand is the hidden command the completion scripts call to get
+// the candidates for the word under the cursor
+const completeCommand = "__complete"
+
+// subcommands lists the subcommands of the commands that have them
+var subcommands = map[string][]string{
+	"cache":      {"path", "status", "logout", "purge", "rekey"},
+	"keys":       {"generate"},
+	"completion": {"bash", "zsh", "fish"},
+}
+
+// completionFlags returns the flag set of the completion command
+func completionFlags() *flag.FlagSet {
+	return newFlagSet("completion", "bash|zsh|fish", "Print a shell completion script. Emails are completed from the token cache and\nbikes from the bikes seen by earlier runs of 'issue' and 'bikes'.\n\n  bash  Add to ~/.bashrc: source <(vanmoof-certificates completion bash)\n  zsh   Add to ~/.zshrc after compinit: source <(vanmoof-certificates completion zsh)\n  fish  Run: vanmoof-certificates completion fish > ~/.config/fish/completions/vanmoof-certificates.fish")
+}
+
+func runCompletion(_ context.Context, args []string) error {
+	fs := completionFlags()
+	fs.Parse(args)
+
+	var script string
+	switch fs.Arg(0) {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		fs.Usage()
+		return usageErrorf("expected shell 'bash', 'zsh' or 'fish'")
+	}
+	fmt.Print(strings.ReplaceAll(script, "PROG", filepath.Base(os.Args[0])))
+	return nil
+}
+
+// The scripts pass the words up to the cursor to the hidden command and
+// fall back to file names when it has no candidates, e.g. for -pubkey-file.
+// Candidates are printed one per line as "value<TAB>description".
+
+const bashCompletion = `# bash completion for PROG
+_vanmoof_certificates() {
+    local IFS=$'\n'
+    COMPREPLY=($("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | cut -f1))
+}
+complete -o default -F _vanmoof_certificates PROG
+`
+
+const zshCompletion = `#compdef PROG
+# zsh completion for PROG
+_vanmoof_certificates() {
+    local -a candidates
+    local line value desc
+    for line in "${(@f)$("${words[1]}" __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+        [[ -z $line ]] && continue
+        value=${line%%$'\t'*}
+        desc=${line#*$'\t'}
+        value=${value//:/\\:}
+        if [[ $line == *$'\t'* && -n $desc ]]; then
+            candidates+=("$value:$desc")
+        else
+            candidates+=("$value")
+        fi
+    done
+    if (( ${#candidates} )); then
+        _describe 'values' candidates
+    else
+        _files
+    fi
+}
+compdef _vanmoof_certificates PROG
+`
+
+const fishCompletion = `# fish completion for PROG
+function __vanmoof_certificates_complete
+    set -l args (commandline -opc)
+    set -l prog $args[1]
+    set -e args[1]
+    set -l cur (commandline -ct)
+    set -l candidates ($prog __complete $args "$cur" 2>/dev/null)
+    if test (count $candidates) -eq 0
+        __fish_complete_path "$cur"
+    else
+        printf '%s\n' $candidates
+    end
+end
+complete -c PROG -f -a '(__vanmoof_certificates_complete)'
+`
+
+// candidate is a completion with an optional description
+type candidate struct {
+	value, description string
+}
+
+// complete prints the candidates for the last of words, which are the
+// arguments up to the cursor. Errors only mean fewer candidates.
+func complete(words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+
+	var candidates []candidate
+	if len(words) == 1 {
+		for _, cmd := range commands {
+			candidates = append(candidates, candidate{cmd.name, cmd.summary})
+		}
+	} else {
+		candidates = completeArgs(words[:len(words)-1], cur)
+	}
+
+	for _, c := range candidates {
+		if len(c.value) >= len(cur) && strings.EqualFold(c.value[:len(cur)], cur) {
+			fmt.Printf("%s\t%s\n", c.value, c.description)
+		}
+	}
+}
+
+// completeArgs returns the candidates for cur after the command words
+func completeArgs(words []string, cur string) []candidate {
+	path := words[:1]
+	if subs := subcommands[words[0]]; len(words) > 1 && slices.Contains(subs, words[1]) {
+		path = words[:2]
+	}
+	flags := commandFlags(path)
+
+	// Find the positional arguments, the flag values and the flag before cur
+	var positional []string
+	var flagName string
+	values := make(map[string]string)
+	for i := len(path); i < len(words); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(words[i], "-"), "=")
+		switch {
+		case !strings.HasPrefix(words[i], "-"):
+			positional = append(positional, words[i])
+			continue
+		case hasValue || !flags[name].takesValue:
+		case i+1 < len(words):
+			value = words[i+1]
+			i++
+		default:
+			flagName = name
+			continue
+		}
+		values[name] = value
+	}
+	o := newCompletionOptions(flags, values)
+
+	switch {
+	case flagName != "":
+		return completeFlagValue(flagName, cur, o)
+	case strings.HasPrefix(cur, "-"):
+		var candidates []candidate
+		for name, f := range flags {
+			candidates = append(candidates, candidate{"-" + name, f.usage})
+		}
+		slices.SortFunc(candidates, func(a, b candidate) int { return strings.Compare(a.value, b.value) })
+		return candidates
+	case len(path) == 1 && len(positional) == 0:
+		var candidates []candidate
+		for _, sub := range subcommands[path[0]] {
+			candidates = append(candidates, candidate{sub, ""})
+		}
+		return candidates
+	case slices.Equal(path, []string{"cache", "logout"}) && len(positional) == 0:
+		return completeEmails(o)
+	}
+	return nil
+}
+
+// completeFlagValue returns the candidates for the value of a flag
+func completeFlagValue(name, cur string, o completionOptions) []candidate {
+	switch name {
+	case "email":
+		return completeEmails(o)
+	case "bikes":
+		// Complete the last bike of a comma-separated list
+		prefix := ""
+		if i := strings.LastIndex(cur, ","); i >= 0 {
+			prefix = cur[:i+1]
+		}
+		chosen := strings.Split(prefix, ",")
+		var candidates []candidate
+		if prefix == "" {
+			candidates = append(candidates, candidate{"all", "All supported bikes"}, candidate{"ask", "Choose interactively"})
+		}
+		for _, c := range completeBikes(o) {
+			if !slices.Contains(chosen, c.value) {
+				candidates = append(candidates, candidate{prefix + c.value, c.description})
+			}
+		}
+		return candidates
+	case "bikeid":
+		return completeBikes(o)
+	case "profile":
+		return completeProfiles(o)
+	case "output", "log-format":
+		return []candidate{{"text", ""}, {"json", ""}}
+	case "log-level":
+		return []candidate{{"debug", ""}, {"info", ""}, {"warn", ""}, {"error", ""}}
+	}
+	return nil
+}
+
+// completionOptions are the flags on the line being completed that select
+// the account and the files candidates come from
+type completionOptions struct {
+	email      string
+	tokenStore string
+	configOptions
+}
+
+// newCompletionOptions reads the completionOptions from the values of the
+// command's flags, and from the profile like the command would
+func newCompletionOptions(flags map[string]flagInfo, values map[string]string) completionOptions {
+	var o completionOptions
+	fs := flag.NewFlagSet(completeCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, ok := flags["email"]; ok {
+		fs.StringVar(&o.email, "email", "", "")
+	}
+	if _, ok := flags["token-store"]; ok {
+		addTokenStoreFlag(fs, &o.tokenStore)
+	}
+	addConfigFlags(fs, &o.configOptions)
+	for name, value := range values {
+		if _, ok := flags[name]; ok && fs.Lookup(name) != nil {
+			fs.Set(name, value)
+		}
+	}
+	o.apply(fs) // A broken profile only means fewer candidates
+	return o
+}
+
+// completeEmails returns the accounts in the token cache and the bike cache
+func completeEmails(o completionOptions) []candidate {
+	var emails []string
+	if store := completionTokenStore(o); store != nil {
+		if cacheMap, err := store.List(context.Background()); err == nil {
+			for email := range cacheMap {
+				emails = append(emails, email)
+			}
+		}
+	}
+	if bikeCache, err := loadBikeCache(o); err == nil {
+		for email := range bikeCache {
+			emails = append(emails, email)
+		}
+	}
+
+	slices.Sort(emails)
+	var candidates []candidate
+	for _, email := range slices.Compact(emails) {
+		candidates = append(candidates, candidate{email, "Cached account"})
+	}
+	return candidates
+}
+
+// completionTokenStore returns the token store to list accounts from if that
+// is cheap, or nil. Completion runs on every TAB press, so files are read
+// without VANMOOF_CACHE_KEY, listing only plaintext caches instead of
+// deriving the key, and helper commands are never run.
+func completionTokenStore(o completionOptions) vanmoof.TokenLister {
+	paths, err := o.paths()
+	if err != nil {
+		return nil
+	}
+	store, err := newTokenStore(o.tokenStore, paths, nil)
+	if err != nil {
+		return nil
+	}
+	switch s := store.(type) {
+	case *vanmoof.FileTokenStore:
+		s.Key = ""
+		return s
+	case *vanmoof.DirTokenStore:
+		s.Key = ""
+		return s
+	}
+	return nil
+}
+
+// completeBikes returns the IDs and frame numbers of the cached supported
+// bikes of the -email account, or of all accounts if it is empty
+func completeBikes(o completionOptions) []candidate {
+	bikeCache, err := loadBikeCache(o)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []candidate
+	seen := make(map[string]bool)
+	for _, account := range slices.Sorted(maps.Keys(bikeCache)) {
+		if o.email != "" && account != o.email {
+			continue
+		}
+		for _, bike := range bikeCache[account] {
+			if seen[bike.FrameNumber] || !vanmoof.IsSupportedBike(bike) {
+				continue
+			}
+			seen[bike.FrameNumber] = true
+			description := fmt.Sprintf("%s (%s)", bike.Name, vanmoof.BikeModel(bike))
+			if bike.BikeID != 0 {
+				candidates = append(candidates, candidate{fmt.Sprintf("%d", bike.BikeID), description})
+			}
+			candidates = append(candidates, candidate{bike.FrameNumber, description})
+		}
+	}
+	return candidates
+}
+
+// completeProfiles returns the profiles in the configuration file
+func completeProfiles(o completionOptions) []candidate {
+	path := cmp.Or(o.file, os.Getenv("VANMOOF_CONFIG"))
+	if path == "" {
+		paths, err := o.paths()
+		if err != nil {
+			return nil
+		}
+		path = paths.Config()
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil
+	}
+	var candidates []candidate
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		candidates = append(candidates, candidate{name, ""})
+	}
+	return candidates
+}
+
+// loadBikeCache returns the bikes seen by earlier runs
+func loadBikeCache(o completionOptions) (map[string][]vanmoof.BikeData, error) {
+	paths, err := o.paths()
+	if err != nil {
+		return nil, err
+	}
+	return vanmoof.LoadBikeCache(paths.BikeCache())
+}
+
+// flagInfo describes a flag of a command
+type flagInfo struct {
+	takesValue bool
+	usage      string
+}
+
+// flagSets builds the flag set of each command and subcommand, keyed by
+// their path, with throwaway options so their flags can be listed
+var flagSets = map[string]func() *flag.FlagSet{
+	"issue":         func() *flag.FlagSet { return issueFlags(new(issueOptions)) },
+	"parse":         func() *flag.FlagSet { return parseFlags(new(parseOptions)) },
+	"keys":          keysFlags,
+	"keys generate": func() *flag.FlagSet { return keysGenerateFlags(new(keysGenerateOptions)) },
+	"bikes":         func() *flag.FlagSet { return bikesFlags(new(bikesOptions)) },
+	"cache":         cacheFlags,
+	"cache path":    func() *flag.FlagSet { return cachePathFlags(new(cacheOptions)) },
+	"cache status":  func() *flag.FlagSet { return cacheStatusFlags(new(cacheOptions)) },
+	"cache logout":  func() *flag.FlagSet { return cacheLogoutFlags(new(cacheOptions)) },
+	"cache purge":   func() *flag.FlagSet { return cachePurgeFlags(new(cacheOptions)) },
+	"cache rekey":   func() *flag.FlagSet { return cacheRekeyFlags(new(cacheOptions)) },
+	"mint":          func() *flag.FlagSet { return mintFlags(new(mintOptions)) },
+	"fakeapi":       func() *flag.FlagSet { return fakeAPIFlags(new(fakeAPIOptions)) },
+	"version":       versionFlags,
+	"completion":    completionFlags,
+}
+
+// commandFlags returns the flags of a command, read from its flag set
+func commandFlags(path []string) map[string]flagInfo {
+	newFlagSet, ok := flagSets[strings.Join(path, " ")]
+	if !ok {
+		return nil
+	}
+	flags := make(map[string]flagInfo)
+	newFlagSet().VisitAll(func(f *flag.Flag) {
+		_, usage := flag.UnquoteUsage(f)
+		usage, _, _ = strings.Cut(usage, "\n")
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags[f.Name] = flagInfo{takesValue: !ok || !boolFlag.IsBoolFlag(), usage: usage}
+	})
+	return flags
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// candidateValues returns the values of candidates separated by spaces
+func candidateValues(candidates []candidate) string {
+	var v []string
+	for _, c := range candidates {
+		v = append(v, c.value)
+	}
+	return strings.Join(v, " ")
+}
+
+func TestFlagSetsCoverCommands(t *testing.T) {
+	var paths []string
+	for _, cmd := range commands {
+		paths = append(paths, cmd.name)
+		for _, sub := range subcommands[cmd.name] {
+			// The shells of the completion command share its flag set
+			if cmd.name != "completion" {
+				paths = append(paths, cmd.name+" "+sub)
+			}
+		}
+	}
+	for _, path := range paths {
+		newFlagSet, ok := flagSets[path]
+		if !ok {
+			t.Errorf("no flag set for '%s'", path)
+			continue
+		}
+		if name := newFlagSet().Name(); name != path {
+			t.Errorf("flag set for '%s' is named '%s'", path, name)
+		}
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	flags := commandFlags([]string{"mint"})
+	for name, takesValue := range map[string]bool{"i": true, "f": true, "b": true, "genca": false} {
+		if f, ok := flags[name]; !ok || f.takesValue != takesValue {
+			t.Errorf("mint -%s: %+v, want takesValue %v", name, f, takesValue)
+		}
+	}
+	if got := flags["f"].usage; got != "Frame module serial (AFM)" {
+		t.Errorf("mint -f usage %q", got)
+	}
+
+	flags = commandFlags([]string{"issue"})
+	for name, takesValue := range map[string]bool{"email": true, "retry-max-time": true, "no-cache": false, "debug-unsafe": false} {
+		if f, ok := flags[name]; !ok || f.takesValue != takesValue {
+			t.Errorf("issue -%s: %+v, want takesValue %v", name, f, takesValue)
+		}
+	}
+}
+
+func TestCompleteArgs(t *testing.T) {
+
+	for _, tc := range []struct {
+		words    []string
+		cur      string
+		contains string
+		empty    bool
+	}{
+		{[]string{"mint", "-i", "5"}, "-", "-f", false},
+		{[]string{"mint", "-i"}, "", "", true},
+		{[]string{"issue", "-no-cache"}, "-", "-email", false},
+		{[]string{"issue", "-output"}, "", "json", false},
+		{[]string{"cache"}, "", "rekey", false},
+		{[]string{"cache", "purge"}, "-", "-revoke", false},
+		{[]string{"keys", "generate"}, "-", "-save", false},
+	} {
+		got := completeArgs(tc.words, tc.cur)
+		if tc.empty && len(got) > 0 {
+			t.Errorf("%q %q: %s, want no candidates", tc.words, tc.cur, candidateValues(got))
+		}
+		if tc.contains != "" && !slices.ContainsFunc(got, func(c candidate) bool { return c.value == tc.contains }) {
+			t.Errorf("%q %q: %s, want %s", tc.words, tc.cur, candidateValues(got), tc.contains)
+		}
+	}
+}
+
+// writeCompletionHome fills a -home directory with a configuration file, the
+// tokens of tokenEmail, encrypted with key if set, and the bikes of bikeEmail
+func writeCompletionHome(t *testing.T, tokenEmail, key, bikeEmail string) string {
+	t.Helper()
+	home := t.TempDir()
+	paths := vanmoof.HomePaths(home)
+	if err := os.MkdirAll(filepath.Dir(paths.Config()), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(paths.Config(), []byte(`{"profiles": {"work": {"home": "`+filepath.ToSlash(home)+`"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := &vanmoof.FileTokenStore{Path: paths.TokenCache(), Key: key}
+	if err := store.Store(context.Background(), tokenEmail, vanmoof.CachedTokens{RefreshToken: "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	bikes, err := json.Marshal(map[string][]vanmoof.BikeData{
+		bikeEmail: {{Name: "Commuter", BikeID: 1001, FrameNumber: "SVTBKL00063OA", BleProfile: "ELECTRIFIED_2022"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(paths.BikeCache(), bikes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return home
+}
+
+func TestCompleteFromFlags(t *testing.T) {
+	isolateEnv(t)
+	plain := writeCompletionHome(t, "tokens@example.com", "", "bikes@example.com")
+	encrypted := writeCompletionHome(t, "secret@example.com", "key", "other@example.com")
+
+	for _, tc := range []struct {
+		name  string
+		words []string
+		want  string
+	}{
+		{"default home", []string{"issue", "-email"}, ""},
+		{"home flag", []string{"issue", "-home", plain, "-email"}, "bikes@example.com tokens@example.com"},
+		{"home from profile", []string{"issue", "-config", vanmoof.HomePaths(plain).Config(), "-profile", "work", "-email"}, "bikes@example.com tokens@example.com"},
+		{"bikes of the email", []string{"issue", "-home=" + plain, "-email", "bikes@example.com", "-bikes"}, "all ask 1001 SVTBKL00063OA"},
+		{"bikes of another email", []string{"issue", "-home=" + plain, "-email", "other@example.com", "-bikes"}, "all ask"},
+		{"profiles", []string{"bikes", "-config", vanmoof.HomePaths(plain).Config(), "-profile"}, "work"},
+		{"encrypted cache", []string{"issue", "-home", encrypted, "-email"}, "other@example.com"},
+		{"cache logout", []string{"cache", "logout", "-home", plain}, "bikes@example.com tokens@example.com"},
+	} {
+		if got := candidateValues(completeArgs(tc.words, "")); got != tc.want {
+			t.Errorf("%s: %q = %q, want %q", tc.name, tc.words, got, tc.want)
+		}
+	}
+
+	// The cache key is not used, so completion never derives it
+	t.Setenv("VANMOOF_CACHE_KEY", "key")
+	if got := candidateValues(completeArgs([]string{"issue", "-home", encrypted, "-email"}, "")); got != "other@example.com" {
+		t.Errorf("with VANMOOF_CACHE_KEY: %q, want only the bike cache", got)
+	}
+
+	// Token store helpers are never run
+	marker := filepath.Join(t.TempDir(), "ran")
+	t.Setenv("VANMOOF_TOKEN_STORE", "command:touch "+marker)
+	completeArgs([]string{"issue", "-home", plain, "-email"}, "")
+	completeArgs([]string{"cache", "logout", "-token-store", "command:touch " + marker}, "")
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("completion ran the token store command")
+	}
+}
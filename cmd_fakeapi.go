@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"vanmoof-certificates/internal/fakeapi"
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// fakeAPIOptions are the inputs of the fakeapi command
+type fakeAPIOptions struct {
+	addr        string
+	caKey       string
+	email       string
+	password    string
+	invitations int
+	appTokenTTL time.Duration
+	fail        string
+}
+
+// fakeAPIFlags registers the flags of the fakeapi command on a new flag set
+func fakeAPIFlags(o *fakeAPIOptions) *flag.FlagSet {
+	fs := newFlagSet("fakeapi", "[flags]", "Serve a fake VanMoof API with a demo account for offline development.\nCertificates are signed by a local test CA; bikes will NOT accept them.")
+	fs.StringVar(&o.addr, "addr", "127.0.0.1:8080", "Address to listen on")
+	fs.StringVar(&o.caKey, "ca", "", "Base64 test CA private key (a new CA is generated if empty)")
+	fs.StringVar(&o.email, "email", "rider@example.com", "Email of the demo account")
+	fs.StringVar(&o.password, "password", "password", "Password of the demo account")
+	fs.IntVar(&o.invitations, "invitations", 0, "Number of pending bike sharing invitations")
+	fs.DurationVar(&o.appTokenTTL, "app-token-ttl", 2*time.Hour, "Lifetime of issued app tokens")
+	fs.StringVar(&o.fail, "fail", "", "Scripted failures as endpoint=kind, comma-separated (kind: 401, 429, 500, malformed, err)")
+	return fs
+}
+
+// runFakeAPI serves a fake VanMoof API for offline development
+func runFakeAPI(ctx context.Context, args []string) error {
+	var o fakeAPIOptions
+	fakeAPIFlags(&o).Parse(args)
+
+	var ca *vanmoof.TestCA
+	var err error
+	if o.caKey != "" {
+		ca, err = vanmoof.TestCAFromPrivateKey(o.caKey)
+	} else {
+		ca, err = vanmoof.NewTestCA()
+		if err == nil {
+			fmt.Printf("CA Privkey = %s\n", base64.StdEncoding.EncodeToString(ca.PrivateKey))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	server, err := fakeapi.New(ca)
+	if err != nil {
+		return err
+	}
+	server.Logger = log.New(os.Stderr, "[fakeapi] ", log.LstdFlags)
+	server.AppTokenTTL = o.appTokenTTL
+
+	account := fakeapi.DemoAccount(o.email, o.password)
+	account.Invitations = o.invitations
+	server.AddAccount(account)
+
+	if err := server.ParseScript(o.fail); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", o.addr)
+	if err != nil {
+		return err
+	}
+	baseURL := "http://" + listener.Addr().String()
+
+	fmt.Printf("CA Pubkey = %s\n", hex.EncodeToString(ca.PublicKey()))
+	fmt.Printf("Account: %s / %s\n", o.email, o.password)
+	fmt.Printf("\nListening on %s. Point the CLI at it with:\n\n", baseURL)
+	fmt.Printf("  export VANMOOF_API_URL=%s/v8\n", baseURL)
+	fmt.Printf("  export VANMOOF_BIKE_API_URL=%s\n", baseURL)
+	fmt.Printf("  export VANMOOF_VEHICLE_REGISTRY_URL=%s\n", baseURL)
+	fmt.Printf("  %s issue -no-cache -email %s -ca %s\n\n", os.Args[0], o.email, hex.EncodeToString(ca.PublicKey()))
+
+	httpServer := &http.Server{Handler: server}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+	if err := httpServer.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// issueOptions are the inputs of the issue command
+type issueOptions struct {
+	email      string
+	bikes      string
+	pubkey     string
+	pubkeyFile string
+	ca         string
+	trustStore string
+	output     string
+	save       bool
+	sudo       bool
+	clientOptions
+}
+
+// issueFlags registers the flags of the issue command on a new flag set
+func issueFlags(o *issueOptions) *flag.FlagSet {
+	fs := newFlagSet("issue", "[flags]", "Request certificates for your SA5/S6 bikes from the VanMoof API.\nA new key pair is generated unless -pubkey is given.")
+	fs.StringVar(&o.email, "email", "", "VanMoof email address (prompted if empty)")
+	fs.StringVar(&o.bikes, "bikes", "all", "Bikes to fetch certificates for: 'all', bike IDs/frame numbers (comma-separated), or 'ask' to be prompted")
+	fs.StringVar(&o.pubkey, "pubkey", "", "Base64 Ed25519 public key to request certificates for (optional)")
+	fs.StringVar(&o.pubkeyFile, "pubkey-file", "", "File with the public key, as base64 or the output of 'keys generate' (optional)")
+	fs.StringVar(&o.ca, "ca", "", "CA public key (hex or base64) to verify certificates against instead of the trust store (optional)")
+	fs.StringVar(&o.trustStore, "trust-store", "", "Path to CA trust store file (default $VANMOOF_TRUST_STORE or truststore.json in the config directory)")
+	fs.StringVar(&o.output, "output", vanmoof.OutputText, "Output format: 'text' or 'json' (one JSON object per bike)")
+	fs.BoolVar(&o.save, "save", false, "Also save each certificate, with the generated private key, as JSON in the certificates directory")
+	addClientFlags(fs, &o.clientOptions)
+	fs.BoolVar(&o.sudo, "sudo", false, "Skip all validation checks")
+	return fs
+}
+
+func runIssue(ctx context.Context, args []string) error {
+	var o issueOptions
+	fs := issueFlags(&o)
+	fs.Parse(args)
+	if err := o.configOptions.setup(fs); err != nil {
+		return err
+	}
+
+	logger, err := o.newLogger(fs)
+	if err != nil {
+		return err
+	}
+	return issue(ctx, logger, o)
+}
+
+// issue validates the options and requests certificates
+func issue(ctx context.Context, logger *slog.Logger, o issueOptions) error {
+	if !vanmoof.IsValidOutputFormat(o.output) {
+		return usageErrorf("invalid output format '%s'. Must be 'text' or 'json'", o.output)
+	}
+
+	if o.pubkeyFile != "" {
+		if o.pubkey != "" {
+			return usageErrorf("-pubkey and -pubkey-file cannot be combined")
+		}
+		pubkey, err := readPublicKeyFile(o.pubkeyFile)
+		if err != nil {
+			return err
+		}
+		o.pubkey = pubkey
+	}
+
+	if o.pubkey != "" && !o.sudo && !vanmoof.IsValidEd25519PublicKey(o.pubkey) {
+		return usageErrorf("invalid Ed25519 public key. Must be base64-encoded 32 or 33 bytes")
+	}
+
+	if err := validateBikeList(o.bikes, o.sudo); err != nil {
+		return err
+	}
+
+	paths, err := o.paths()
+	if err != nil {
+		return err
+	}
+	store, err := loadTrustStore(o.ca, o.trustStore, paths)
+	if err != nil {
+		return err
+	}
+
+	client, err := newClient(&o.clientOptions, logger)
+	if err != nil {
+		return err
+	}
+	if o.save {
+		client.CertificateDir = paths.Certificates()
+	}
+
+	if o.replay != "" {
+		if o.email == "" {
+			o.email = replayEmail
+		}
+		// The recorded certificates are only valid for the recorded key
+		if replay, ok := client.HTTPClient.Transport.(*vanmoof.ReplayTransport); ok && o.pubkey == "" {
+			o.pubkey = replay.PublicKey()
+		}
+	}
+	email, err := resolveEmail(ctx, o.email, o.sudo)
+	if err != nil {
+		return err
+	}
+
+	return client.GetCertContext(ctx, email, o.bikes, o.pubkey, store, o.output, o.noCache)
+}
+
+// readPublicKeyFile reads a base64 public key from a file holding only the
+// key, or the "Pubkey = ..." line printed by 'keys generate'
+func readPublicKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read public key: %w", err)
+	}
+	for line := range strings.Lines(string(data)) {
+		if pubkey, ok := strings.CutPrefix(strings.TrimSpace(line), "Pubkey = "); ok {
+			return pubkey, nil
+		}
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// validateBikeList checks the -bikes value: 'all', 'ask' or comma-separated IDs/frame numbers
+func validateBikeList(bikes string, sudo bool) error {
+	if bikes == "all" || bikes == "ask" {
+		return nil
+	}
+	for _, id := range strings.Split(bikes, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			return usageErrorf("empty bike ID in bikes list")
+		}
+		var numericID uint32
+		if _, err := fmt.Sscanf(id, "%d", &numericID); err != nil {
+			if !sudo && !vanmoof.ValidateFrameNumber(id) {
+				return usageErrorf("invalid bike ID '%s' in bikes list. Must be a numeric ID or frame number", id)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveEmail returns the given email or prompts for one, and validates it.
+// The prompt is abandoned if ctx is cancelled.
+func resolveEmail(ctx context.Context, email string, sudo bool) (string, error) {
+	if email == "" {
+		fmt.Fprint(os.Stderr, "Enter VanMoof email: ")
+		type result struct {
+			input string
+			err   error
+		}
+		done := make(chan result, 1)
+		go func() {
+			input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			done <- result{input, err}
+		}()
+
+		var r result
+		select {
+		case r = <-done:
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr)
+			return "", ctx.Err()
+		}
+		if r.err != nil {
+			return "", fmt.Errorf("error reading email: %w", r.err)
+		}
+		email = strings.TrimSpace(r.input)
+	}
+
+	if !sudo && !vanmoof.IsValidEmail(email) {
+		return "", usageErrorf("invalid email address '%s'", email)
+	}
+	return email, nil
+}
+
+// loadTrustStore returns a store with only the given CA key, or the
+// configured trust store, by default the one in paths
+func loadTrustStore(ca, path string, paths vanmoof.Paths) (*vanmoof.TrustStore, error) {
+	if ca != "" {
+		caKey, err := vanmoof.ParseCAPublicKey(ca)
+		if err != nil {
+			return nil, usageErrorf("invalid CA public key: %w", err)
+		}
+		return &vanmoof.TrustStore{CAs: []vanmoof.TrustedCA{{Label: "command line", PublicKey: caKey}}}, nil
+	}
+
+	store, err := vanmoof.ResolveTrustStore(path, paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trust store: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// parseResults parses the JSON Lines printed by 'issue -output json'
+func parseResults(t *testing.T, out []byte) []vanmoof.IssuedCertificate {
+	t.Helper()
+	var results []vanmoof.IssuedCertificate
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var result vanmoof.IssuedCertificate
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("invalid JSON output %q: %v", scanner.Text(), err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestIssueRecordReplay(t *testing.T) {
+	const email, password = "rider@example.com", "s3cret-passw0rd"
+	isolateEnv(t)
+	_, ca, url := startFakeAPI(t, email, password)
+	t.Setenv("VANMOOF_PASSWORD", password)
+	cassette := filepath.Join(t.TempDir(), "cassette")
+	caKey := hex.EncodeToString(ca.PublicKey())
+	ctx := context.Background()
+
+	out, err := captureStdout(t, func() error {
+		return runIssue(ctx, []string{"-email", email, "-record", cassette, "-ca", caKey, "-output", "json",
+			"-api-url", url + "/v8", "-bike-api-url", url, "-vehicle-registry-url", url, "-retries", "0"})
+	})
+	if err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	recorded := parseResults(t, out)
+	if len(recorded) != 3 {
+		t.Fatalf("recorded %d certificates, want 3", len(recorded))
+	}
+
+	// No secrets end up in the cassette
+	files, err := filepath.Glob(filepath.Join(cassette, "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("cassette files %v, %v", files, err)
+	}
+	basic := base64.StdEncoding.EncodeToString([]byte(email + ":" + password))
+	refreshToken := regexp.MustCompile(`"refreshToken":\s*"([^"]*)"`)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{password, email, basic, "eyJ", recorded[0].PrivateKey} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains %q", filepath.Base(file), secret)
+			}
+		}
+		for _, m := range refreshToken.FindAllStringSubmatch(string(data), -1) {
+			if m[1] != "REDACTED" {
+				t.Errorf("%s contains refresh token %q", filepath.Base(file), m[1])
+			}
+		}
+	}
+
+	// Replaying needs neither the network nor the password, and reuses the recorded key
+	t.Setenv("VANMOOF_PASSWORD", "")
+	out, err = captureStdout(t, func() error {
+		return runIssue(ctx, []string{"-replay", cassette, "-ca", caKey, "-output", "json"})
+	})
+	if err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	replayed := parseResults(t, out)
+	if len(replayed) != len(recorded) {
+		t.Fatalf("replayed %d certificates, want %d", len(replayed), len(recorded))
+	}
+	for i, result := range replayed {
+		want := recorded[i]
+		if result.Bike.FrameNumber != want.Bike.FrameNumber || result.Certificate != want.Certificate || result.PublicKey != want.PublicKey {
+			t.Errorf("replayed %s with key %s, recorded %s with key %s", result.Bike.FrameNumber, result.PublicKey, want.Bike.FrameNumber, want.PublicKey)
+		}
+		if result.Error != "" || result.Report == nil || !result.Report.Valid() {
+			t.Errorf("%s: error %q, report %+v", result.Bike.FrameNumber, result.Error, result.Report)
+		}
+	}
+}
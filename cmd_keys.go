@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// keysFlags returns the flag set of the keys command
+func keysFlags() *flag.FlagSet {
+	return newFlagSet("keys", "generate [flags]", "Generate an Ed25519 key pair to reuse for certificate requests (issue -pubkey).")
+}
+
+func runKeys(_ context.Context, args []string) error {
+	fs := keysFlags()
+	fs.Parse(args)
+
+	switch fs.Arg(0) {
+	case "generate":
+		return keysGenerate(fs.Args()[1:])
+	default:
+		fs.Usage()
+		return usageErrorf("expected subcommand 'generate'")
+	}
+}
+
+// keysGenerateOptions are the inputs of 'keys generate'
+type keysGenerateOptions struct {
+	name string
+	configOptions
+}
+
+// keysGenerateFlags registers the flags of 'keys generate' on a new flag set
+func keysGenerateFlags(o *keysGenerateOptions) *flag.FlagSet {
+	fs := newFlagSet("keys generate", "[flags]", "Generate an Ed25519 key pair and print it. With -save it is also written to the keys directory,\nfor use with 'issue -pubkey-file'.")
+	fs.StringVar(&o.name, "save", "", "Also save the key pair under this name in the keys directory")
+	addConfigFlags(fs, &o.configOptions)
+	return fs
+}
+
+// keysGenerate parses the flags of 'keys generate'
+func keysGenerate(args []string) error {
+	var o keysGenerateOptions
+	fs := keysGenerateFlags(&o)
+	fs.Parse(args)
+	if err := o.configOptions.setup(fs); err != nil {
+		return err
+	}
+
+	if o.name == "" {
+		return generateKeys("")
+	}
+	if o.name == "." || o.name == ".." || strings.ContainsAny(o.name, `/\`) {
+		return usageErrorf("invalid key name '%s'", o.name)
+	}
+	paths, err := o.paths()
+	if err != nil {
+		return err
+	}
+	return generateKeys(filepath.Join(paths.Keys(), o.name+".key"))
+}
+
+// generateKeys prints a new Ed25519 key pair, and writes it to path unless
+// path is empty. An existing file is never replaced.
+func generateKeys(path string) error {
+	var f *os.File
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return fmt.Errorf("failed to create keys dir: %w", err)
+		}
+		var err error
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to save key pair: %w", err)
+		}
+		defer f.Close()
+	}
+
+	privKeyB64, pubKeyB64, err := vanmoof.GenerateED25519()
+	if err != nil {
+		if f != nil {
+			os.Remove(path)
+		}
+		return fmt.Errorf("generating key pair: %w", err)
+	}
+	keyPair := fmt.Sprintf("Privkey = %s\nPubkey = %s\n", privKeyB64, pubKeyB64)
+	fmt.Print(keyPair)
+
+	if f == nil {
+		return nil
+	}
+	if _, err := f.WriteString(keyPair); err != nil {
+		return fmt.Errorf("failed to save key pair: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to save key pair: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Saved to %s\n", path)
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// mintOptions are the inputs of the mint command
+type mintOptions struct {
+	genca  bool
+	caKey  string
+	id     uint
+	frame  string
+	bike   string
+	expiry string
+	role   uint
+	user   string
+	pubkey string
+}
+
+// mintFlags registers the flags of the mint command on a new flag set
+func mintFlags(o *mintOptions) *flag.FlagSet {
+	fs := newFlagSet("mint", "[flags]", "Issue a certificate signed by a local test CA. Bikes will NOT accept it.")
+	fs.BoolVar(&o.genca, "genca", false, "Generate a test CA key pair and exit")
+	fs.StringVar(&o.caKey, "ca", "", "Base64 test CA private key (a new CA is generated if empty)")
+	fs.UintVar(&o.id, "i", 1337, "Bike API ID")
+	fs.StringVar(&o.frame, "f", "SVTBKL00000OA", "Frame module serial (AFM)")
+	fs.StringVar(&o.bike, "b", "", "Bike module serial (ABM), defaults to -f")
+	fs.StringVar(&o.expiry, "e", "168h", "Expiry as Unix timestamp or duration from now (e.g. 168h, -1h)")
+	fs.UintVar(&o.role, "r", 0x07, "Role/access level")
+	fs.StringVar(&o.user, "u", "", "User UUID, hyphens optional (random UUIDv4 if empty)")
+	fs.StringVar(&o.pubkey, "p", "", "Base64 Ed25519 public key to embed (a new key pair is generated if empty)")
+	return fs
+}
+
+// runMint issues certificates signed by a local test CA
+func runMint(_ context.Context, args []string) error {
+	var o mintOptions
+	mintFlags(&o).Parse(args)
+
+	// The payload fields are narrower than the flags; truncating would mint e.g. -r 263 as owner
+	if o.id > math.MaxUint32 {
+		return usageErrorf("invalid -i %d: must be at most %d", o.id, uint32(math.MaxUint32))
+	}
+	if o.role > math.MaxUint8 {
+		return usageErrorf("invalid -r %d: must be at most %d", o.role, math.MaxUint8)
+	}
+
+	if o.genca {
+		privKeyB64, pubKeyB64, err := vanmoof.GenerateED25519()
+		if err != nil {
+			return fmt.Errorf("generating CA key pair: %w", err)
+		}
+		fmt.Printf("CA Privkey = %s\n", privKeyB64)
+		fmt.Printf("CA Pubkey = %s\n", pubKeyB64)
+		return nil
+	}
+
+	var ca *vanmoof.TestCA
+	var err error
+	if o.caKey != "" {
+		ca, err = vanmoof.TestCAFromPrivateKey(o.caKey)
+	} else {
+		ca, err = vanmoof.NewTestCA()
+		if err == nil {
+			fmt.Printf("CA Privkey = %s\n", base64.StdEncoding.EncodeToString(ca.PrivateKey))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	expiryTS, err := parseExpiry(o.expiry)
+	if err != nil {
+		return usageErrorf("invalid expiry '%s': %w", o.expiry, err)
+	}
+
+	userID, err := parseUserID(o.user)
+	if err != nil {
+		return usageErrorf("invalid user UUID '%s': %w", o.user, err)
+	}
+
+	pubKeyB64 := o.pubkey
+	if pubKeyB64 == "" {
+		var privKeyB64 string
+		privKeyB64, pubKeyB64, err = vanmoof.GenerateED25519()
+		if err != nil {
+			return fmt.Errorf("generating key pair: %w", err)
+		}
+		fmt.Printf("Privkey = %s\n", privKeyB64)
+	}
+	pubKeyBytes, err := base64.StdEncoding.DecodeString(pubKeyB64)
+	if err != nil {
+		return usageErrorf("invalid base64 public key: %w", err)
+	}
+
+	bikeSerial := o.bike
+	if bikeSerial == "" {
+		bikeSerial = o.frame
+	}
+
+	certData, err := ca.Issue(vanmoof.CertificatePayload{
+		ID:        uint32(o.id),
+		FrameID:   o.frame,
+		BikeID:    bikeSerial,
+		Expiry:    expiryTS,
+		Role:      uint8(o.role),
+		UserID:    userID,
+		PublicKey: pubKeyBytes,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("CA Pubkey = %s\n", base64.StdEncoding.EncodeToString(ca.PublicKey()))
+	fmt.Printf("Pubkey = %s\n", pubKeyB64)
+	fmt.Printf("Certificate = %s\n", base64.StdEncoding.EncodeToString(certData))
+	return nil
+}
+
+// parseExpiry accepts a Unix timestamp or a duration relative to now
+func parseExpiry(s string) (uint32, error) {
+	if ts, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(ts), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("expected Unix timestamp or duration")
+	}
+	ts := time.Now().Add(d).Unix()
+	if ts < 0 || ts > math.MaxUint32 {
+		return 0, fmt.Errorf("%s from now is outside the 32-bit Unix time range", d)
+	}
+	return uint32(ts), nil
+}
+
+// parseUserID decodes a hex UUID (hyphens optional), or returns a random UUIDv4 for ""
+func parseUserID(s string) ([]byte, error) {
+	if s == "" {
+		uuid := make([]byte, 16)
+		if _, err := rand.Read(uuid); err != nil {
+			return nil, err
+		}
+		uuid[6] = (uuid[6] & 0x0f) | 0x40 // version 4
+		uuid[8] = (uuid[8] & 0x3f) | 0x80 // RFC 4122 variant
+		return uuid, nil
+	}
+	return hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+}
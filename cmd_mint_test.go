@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunMintRejectsOutOfRange(t *testing.T) {
+	for _, args := range [][]string{
+		{"-r", "263"},
+		{"-i", "4294967296"},
+		{"-e", "-500000h"},
+	} {
+		err := runMint(context.Background(), args)
+		if !errors.As(err, new(usageError)) {
+			t.Errorf("mint %q: error %v, want a usage error", args, err)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	if ts, err := parseExpiry("1767668550"); err != nil || ts != 1767668550 {
+		t.Errorf("parseExpiry(timestamp) = %d, %v", ts, err)
+	}
+	ts, err := parseExpiry("-1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Now().Add(-time.Hour).Unix(); int64(ts) < want-5 || int64(ts) > want+5 {
+		t.Errorf("parseExpiry(-1h) = %d, want about %d", ts, want)
+	}
+	for _, s := range []string{"4294967296", "soon", "-500000h"} {
+		if _, err := parseExpiry(s); err == nil {
+			t.Errorf("parseExpiry(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// parseOptions are the inputs of the parse command
+type parseOptions struct {
+	cert       string
+	pubkey     string
+	bikeid     string
+	ca         string
+	trustStore string
+	output     string
+	debug      bool
+	sudo       bool
+	configOptions
+}
+
+// parseFlags registers the flags of the parse command on a new flag set
+func parseFlags(o *parseOptions) *flag.FlagSet {
+	fs := newFlagSet("parse", "[flags] <certificate>", "Parse and verify a base64 certificate. Use '-' to read it from stdin.")
+	fs.StringVar(&o.pubkey, "pubkey", "", "Base64 public key the certificate is expected to contain (optional)")
+	fs.StringVar(&o.bikeid, "bikeid", "", "Bike ID or frame number the certificate is expected to be for (optional)")
+	fs.StringVar(&o.ca, "ca", "", "CA public key (hex or base64) to verify the signature against instead of the trust store (optional)")
+	fs.StringVar(&o.trustStore, "trust-store", "", "Path to CA trust store file (default $VANMOOF_TRUST_STORE or truststore.json in the config directory)")
+	fs.StringVar(&o.output, "output", vanmoof.OutputText, "Output format: 'text' or 'json'")
+	fs.BoolVar(&o.debug, "debug", false, "Show full certificate and signature details")
+	fs.BoolVar(&o.sudo, "sudo", false, "Skip all validation checks")
+	addConfigFlags(fs, &o.configOptions)
+	return fs
+}
+
+func runParse(_ context.Context, args []string) error {
+	var o parseOptions
+	fs := parseFlags(&o)
+	fs.Parse(args)
+	if err := o.configOptions.setup(fs); err != nil {
+		return err
+	}
+
+	// Parsing does not log; the logger only echoes the flags in debug mode
+	if _, err := (logOptions{debug: o.debug}).newLogger(fs); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return usageErrorf("expected exactly one certificate")
+	}
+	o.cert = fs.Arg(0)
+	if o.cert == "-" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("error reading certificate from stdin: %w", err)
+		}
+		o.cert = strings.TrimSpace(line)
+	}
+
+	return parseCert(o)
+}
+
+// parseCert validates the options, then parses and verifies the certificate
+func parseCert(o parseOptions) error {
+	if !vanmoof.IsValidOutputFormat(o.output) {
+		return usageErrorf("invalid output format '%s'. Must be 'text' or 'json'", o.output)
+	}
+
+	if !o.sudo && !vanmoof.IsValidBase64(o.cert) {
+		return fmt.Errorf("%w: not a base64 string", vanmoof.ErrInvalidCertificate)
+	}
+
+	if o.pubkey != "" && !o.sudo && !vanmoof.IsValidEd25519PublicKey(o.pubkey) {
+		return usageErrorf("invalid Ed25519 public key. Must be base64-encoded 32 or 33 bytes")
+	}
+
+	if o.bikeid != "" && !o.sudo && !vanmoof.IsValidBikeID(o.bikeid) {
+		return usageErrorf("invalid bike ID '%s'. Must be a numeric ID or valid frame number pattern", o.bikeid)
+	}
+
+	paths, err := o.paths()
+	if err != nil {
+		return err
+	}
+	store, err := loadTrustStore(o.ca, o.trustStore, paths)
+	if err != nil {
+		return err
+	}
+
+	return vanmoof.ProcessCertificate(o.cert, vanmoof.VerifyOptions{
+		PublicKey:  o.pubkey,
+		BikeID:     o.bikeid,
+		TrustStore: store,
+	}, o.output, o.debug)
+}
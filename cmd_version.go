@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"runtime"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+func runVersion(_ context.Context, args []string) error {
+	versionFlags().Parse(args)
+
+	fmt.Println("vanmoof-certificates version", vanmoof.Version)
+	fmt.Printf("OS: %s, Arch: %s, Go: %s, CPUs: %d, Compiler: %s\n", runtime.GOOS, runtime.GOARCH, runtime.Version(), runtime.NumCPU(), runtime.Compiler)
+	return nil
+}
+
+// versionFlags returns the flag set of the version command
+func versionFlags() *flag.FlagSet {
+	return newFlagSet("version", "", "Print version information.")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// config is the configuration file. A profile maps flag names to values, e.g.
+//
+//	{
+//	  "default_profile": "family",
+//	  "profiles": {
+//	    "family": {"email": "me@example.com", "bikes": ["1234", "5678"], "no-cache": true}
+//	  }
+//	}
+type config struct {
+	DefaultProfile string                                `json:"default_profile"`
+	Profiles       map[string]map[string]json.RawMessage `json:"profiles"`
+}
+
+// configOptions are the flags selecting the configuration file, profile and
+// the directory of persisted files
+type configOptions struct {
+	file    string
+	profile string
+	home    string
+}
+
+// addConfigFlags registers the -config, -profile and -home flags on fs
+func addConfigFlags(fs *flag.FlagSet, o *configOptions) {
+	fs.StringVar(&o.file, "config", "", "Configuration file with profiles (default $VANMOOF_CONFIG or config.json in the config directory)")
+	fs.StringVar(&o.profile, "profile", "", "Profile from the configuration file providing the flags not given on the command line (default $VANMOOF_PROFILE or the file's default_profile)")
+	fs.StringVar(&o.home, "home", "", "Keep configuration, tokens and cached data in this directory instead of the XDG base directories (default $VANMOOF_HOME)")
+}
+
+// paths returns where files are persisted: in the -home directory if given,
+// and otherwise see vanmoof.DefaultPaths
+func (o configOptions) paths() (vanmoof.Paths, error) {
+	if o.home != "" {
+		return vanmoof.HomePaths(o.home), nil
+	}
+	return vanmoof.DefaultPaths()
+}
+
+// apply sets the flags of fs that were not given on the command line to the
+// values of the selected profile, so that flags override the profile and the
+// profile overrides the defaults. Values for flags fs does not define are
+// ignored, so one profile can serve several commands. Without a
+// configuration file nothing happens, unless one was asked for.
+func (o configOptions) apply(fs *flag.FlagSet) error {
+	path, profile := o.file, o.profile
+	if path == "" {
+		path = os.Getenv("VANMOOF_CONFIG")
+	}
+	if profile == "" {
+		profile = os.Getenv("VANMOOF_PROFILE")
+	}
+	required := path != "" || profile != ""
+	if path == "" {
+		paths, err := o.paths()
+		if err != nil {
+			return err
+		}
+		path = paths.Config()
+	}
+
+	cfg, err := loadConfig(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if profile == "" {
+		profile = cfg.DefaultProfile
+		if profile == "" {
+			return nil
+		}
+	}
+	values, ok := cfg.Profiles[profile]
+	if !ok {
+		return fmt.Errorf("profile '%s' not found in %s", profile, path)
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if given[name] || fs.Lookup(name) == nil || name == "config" || name == "profile" {
+			continue
+		}
+		value, err := configValue(values[name])
+		if err != nil {
+			return fmt.Errorf("profile '%s': %s: %w", profile, name, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("profile '%s': invalid value for %s: %w", profile, name, err)
+		}
+	}
+	return nil
+}
+
+// setup applies the profile to fs, see apply, and then moves the files left
+// by earlier versions to the default locations. This waits for the profile,
+// as a directory given with -home, on the command line or in the profile, is
+// used as is and receives no legacy files.
+func (o *configOptions) setup(fs *flag.FlagSet) error {
+	if err := o.apply(fs); err != nil {
+		return err
+	}
+	if o.home == "" {
+		if paths, err := vanmoof.DefaultPaths(); err == nil {
+			migrateLegacyFiles(paths)
+		}
+	}
+	return nil
+}
+
+// loadConfig reads and parses a configuration file
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// configValue converts a profile value to the flag syntax: strings are used
+// as is, booleans and numbers as written, and lists are joined by commas
+func configValue(raw json.RawMessage) (string, error) {
+	var value any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return "", err
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool, json.Number:
+		return fmt.Sprint(v), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case string, json.Number:
+				items[i] = fmt.Sprint(item)
+			default:
+				return "", errors.New("lists may only hold strings and numbers")
+			}
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", errors.New("must be a string, boolean, number or list")
+	}
+}
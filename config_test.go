@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+func TestHomeFlag(t *testing.T) {
+	t.Setenv("VANMOOF_HOME", "")
+	t.Setenv("VANMOOF_CONFIG", "")
+	t.Setenv("VANMOOF_PROFILE", "")
+	home := t.TempDir()
+
+	var co configOptions
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	addConfigFlags(fs, &co)
+	if err := fs.Parse([]string{"-home", home}); err != nil {
+		t.Fatal(err)
+	}
+	if err := co.apply(fs); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := co.paths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{paths.Config(), paths.TokenCache(), paths.TrustStore(), paths.BikeCache(), paths.Keys(), paths.Certificates()} {
+		if filepath.Dir(path) != home {
+			t.Errorf("%s is not in the home directory %s", path, home)
+		}
+	}
+	if env := os.Getenv("VANMOOF_HOME"); env != "" {
+		t.Errorf("-home set VANMOOF_HOME to %s", env)
+	}
+}
+
+func TestHomeFlagFromProfile(t *testing.T) {
+	t.Setenv("VANMOOF_HOME", "")
+	t.Setenv("VANMOOF_PROFILE", "")
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte(`{"default_profile":"p","profiles":{"p":{"home":"`+filepath.ToSlash(home)+`"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var co configOptions
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	addConfigFlags(fs, &co)
+	if err := fs.Parse([]string{"-config", config}); err != nil {
+		t.Fatal(err)
+	}
+	if err := co.apply(fs); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := co.paths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Dir(paths.TokenCache()); got != filepath.FromSlash(home) {
+		t.Errorf("token cache in %s, want the profile's home %s", got, home)
+	}
+}
+
+func TestSetupMigratesWithoutHome(t *testing.T) {
+	isolateEnv(t)
+	legacyTokens := filepath.Join(os.Getenv("HOME"), ".vanmoof-certificates", "tokens.json")
+	defaults, err := vanmoof.DefaultPaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"profiles":{"p":{"home":"`+filepath.ToSlash(home)+`"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		migrated bool
+	}{
+		{[]string{"-home", home}, false},
+		{[]string{"-config", config, "-profile", "p"}, false},
+		{nil, true},
+	} {
+		if err := os.MkdirAll(filepath.Dir(legacyTokens), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(legacyTokens, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		var co configOptions
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		addConfigFlags(fs, &co)
+		if err := fs.Parse(tc.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := co.setup(fs); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := os.Stat(defaults.TokenCache())
+		if migrated := err == nil; migrated != tc.migrated {
+			t.Errorf("%q: token cache moved to %s = %v, want %v", tc.args, defaults.TokenCache(), migrated, tc.migrated)
+		}
+		for _, path := range []string{vanmoof.HomePaths(home).TokenCache(), vanmoof.HomePaths(home).TrustStore()} {
+			if _, err := os.Stat(path); err == nil {
+				t.Errorf("%q: legacy file moved into -home: %s", tc.args, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package fakeapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Endpoint names used to script failures
+const (
+	EndpointAuthenticate           = "authenticate"
+	EndpointToken                  = "token"
+	EndpointLogout                 = "logout"
+	EndpointApplicationToken       = "getApplicationToken"
+	EndpointCustomerData           = "getCustomerData"
+	EndpointBikeSharingInvitations = "getBikeSharingInvitations"
+	EndpointRiderVehicles          = "vehicles"
+	EndpointCreateCertificate      = "create_certificate"
+)
+
+var endpoints = []string{
+	EndpointAuthenticate,
+	EndpointToken,
+	EndpointLogout,
+	EndpointApplicationToken,
+	EndpointCustomerData,
+	EndpointBikeSharingInvitations,
+	EndpointRiderVehicles,
+	EndpointCreateCertificate,
+}
+
+// Failure is a scripted response returned instead of the normal one
+type Failure struct {
+	Status int
+	Header http.Header
+	Body   string
+
+	// RateLimitReset adds x-ratelimit-* headers reporting an exhausted
+	// limit that resets this long after the response is sent
+	RateLimitReset time.Duration
+}
+
+// Unauthorized returns a 401 failure
+func Unauthorized() Failure {
+	return Failure{Status: http.StatusUnauthorized, Body: `{"message":"Unauthorized"}`}
+}
+
+// RateLimited returns a 429 failure with x-ratelimit-* headers resetting after reset
+func RateLimited(reset time.Duration) Failure {
+	return Failure{Status: http.StatusTooManyRequests, Body: `{"message":"Too Many Requests"}`, RateLimitReset: reset}
+}
+
+// ServerError returns a 500 failure
+func ServerError() Failure {
+	return Failure{Status: http.StatusInternalServerError, Body: `{"message":"Internal Server Error"}`}
+}
+
+// MalformedJSON returns a 200 response with a truncated JSON body
+func MalformedJSON() Failure {
+	return Failure{Status: http.StatusOK, Body: `{"token": "`}
+}
+
+// ErrorBody returns a 200 response with an {"err": ...} body, as the bike API
+// does when it refuses a request
+func ErrorBody(message string) Failure {
+	return Failure{Status: http.StatusOK, Body: fmt.Sprintf(`{"err":%q}`, message)}
+}
+
+// ParseFailure parses a failure kind: 401, 429, 500, 'malformed' or 'err'
+func ParseFailure(kind string) (Failure, error) {
+	switch kind {
+	case "401":
+		return Unauthorized(), nil
+	case "429":
+		return RateLimited(5 * time.Second), nil
+	case "500":
+		return ServerError(), nil
+	case "malformed":
+		return MalformedJSON(), nil
+	case "err":
+		return ErrorBody("scripted failure"), nil
+	default:
+		return Failure{}, fmt.Errorf("unknown failure '%s'. Must be 401, 429, 500, 'malformed' or 'err'", kind)
+	}
+}
+
+// ParseScript parses a comma-separated list of endpoint=kind failures, e.g.
+// "authenticate=401,create_certificate=429". An endpoint may be listed
+// several times to fail several consecutive requests.
+func (s *Server) ParseScript(script string) error {
+	for _, entry := range strings.Split(script, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		endpoint, kind, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid failure '%s'. Must be endpoint=kind", entry)
+		}
+		failure, err := ParseFailure(kind)
+		if err != nil {
+			return err
+		}
+		if err := s.Fail(endpoint, failure); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fail queues failures for an endpoint. Each request to the endpoint consumes
+// one failure until the queue is empty, after which it behaves normally.
+func (s *Server) Fail(endpoint string, failures ...Failure) error {
+	known := false
+	for _, e := range endpoints {
+		if e == endpoint {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown endpoint '%s'. Must be one of: %s", endpoint, strings.Join(endpoints, ", "))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], failures...)
+	return nil
+}
+
+// nextFailure pops the next scripted failure for an endpoint
+func (s *Server) nextFailure(endpoint string) (Failure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.failures[endpoint]
+	if len(queue) == 0 {
+		return Failure{}, false
+	}
+	s.failures[endpoint] = queue[1:]
+	return queue[0], true
+}
+
+// write sends the failure response
+func (f Failure) write(w http.ResponseWriter) {
+	for key, values := range f.Header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	if f.RateLimitReset > 0 {
+		w.Header().Set("x-ratelimit-limit", "100")
+		w.Header().Set("x-ratelimit-remaining", "0")
+		w.Header().Set("x-ratelimit-reset", strconv.FormatInt(time.Now().Add(f.RateLimitReset).Unix(), 10))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(f.Status)
+	fmt.Fprint(w, f.Body)
+}
@@ -0,0 +1,437 @@
+package fakeapi
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// Token audiences, used to tell auth and application tokens apart
+const (
+	audienceAuth = "auth"
+	audienceApp  = "app"
+)
+
+// Account is a customer of the fake API
+type Account struct {
+	Email       string
+	Password    string
+	UUID        string
+	Bikes       []vanmoof.BikeData      // Owned bikes, returned by getCustomerData
+	Shared      []vanmoof.VehicleAccess // Bikes shared with the account, returned by the vehicle registry
+	Invitations int                     // Pending bike sharing invitations
+
+	generation int // Incremented by logout; tokens of earlier generations are rejected
+}
+
+// Server is a fake VanMoof API. It serves the VanMoof API under /v8 and the
+// bike API and vehicle registry at the root, so one base URL covers all three.
+type Server struct {
+	CA *vanmoof.TestCA // Signs issued certificates
+
+	AuthTokenTTL   time.Duration
+	AppTokenTTL    time.Duration
+	CertificateTTL time.Duration
+
+	// Logger receives one line per request; nil disables logging
+	Logger *log.Logger
+
+	mu            sync.Mutex
+	accounts      map[string]*Account // keyed by email
+	refreshTokens map[string]string   // refresh token -> email
+	failures      map[string][]Failure
+	secret        []byte // HMAC key for issued JWTs
+	mux           *http.ServeMux
+}
+
+// New returns a fake API signing certificates with ca and without accounts
+func New(ca *vanmoof.TestCA) (*Server, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		CA:             ca,
+		AuthTokenTTL:   365 * 24 * time.Hour,
+		AppTokenTTL:    2 * time.Hour,
+		CertificateTTL: 7 * 24 * time.Hour,
+		accounts:       make(map[string]*Account),
+		refreshTokens:  make(map[string]string),
+		failures:       make(map[string][]Failure),
+		secret:         secret,
+		mux:            http.NewServeMux(),
+	}
+
+	s.handle("POST /v8/authenticate", EndpointAuthenticate, s.handleAuthenticate)
+	s.handle("POST /v8/token", EndpointToken, s.handleToken)
+	s.handle("POST /v8/logout", EndpointLogout, s.handleLogout)
+	s.handle("GET /v8/getApplicationToken", EndpointApplicationToken, s.handleApplicationToken)
+	s.handle("GET /v8/getCustomerData", EndpointCustomerData, s.handleCustomerData)
+	s.handle("GET /v8/getBikeSharingInvitations", EndpointBikeSharingInvitations, s.handleBikeSharingInvitations)
+	s.handle("GET /external/riders/{uuid}/vehicles", EndpointRiderVehicles, s.handleRiderVehicles)
+	s.handle("POST /bikes/{id}/create_certificate", EndpointCreateCertificate, s.handleCreateCertificate)
+	return s, nil
+}
+
+// DemoAccount returns an account owning an SA5, an S6 and an unsupported
+// S3, with an S6 shared by another rider
+func DemoAccount(email, password string) Account {
+	return Account{
+		Email:    email,
+		Password: password,
+		UUID:     "3f2a8c1e-7b4d-4e9a-9c6f-2d1b0a8e5f47",
+		Bikes: []vanmoof.BikeData{
+			{Name: "My S5", BikeID: 1001, FrameNumber: "SVTBKL00063OA", FrameSerial: "SVTBKL00063OA", BleProfile: "ELECTRIFIED_2022", MainEcuSerial: "SVTBKL00063OA"},
+			{Name: "My S6", BikeID: 1002, FrameNumber: "TVSEF300106TA", FrameSerial: "TVSEF300106TA", BleProfile: "ELECTRIFIED_2025", MainEcuSerial: "TVSEF300106TA"},
+			{Name: "Old S3", BikeID: 1003, FrameNumber: "ASY1234567", BleProfile: "ELECTRIFIED_2018"},
+		},
+		Shared: []vanmoof.VehicleAccess{
+			{VehicleID: "TVSEF300207TA", Role: "guest", Name: "Partner's S6", BleProfile: "ELECTRIFIED_2025", OwnerName: "Alex"},
+		},
+	}
+}
+
+// AddAccount adds or replaces an account
+func (s *Server) AddAccount(a Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[a.Email] = &a
+}
+
+// NewClient returns a client pointed at a fake API listening on baseURL
+func NewClient(baseURL string) *vanmoof.Client {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	c := vanmoof.NewClient()
+	c.APIBaseURL = baseURL + "/v8"
+	c.BikeAPIBaseURL = baseURL
+	c.VehicleRegistryBaseURL = baseURL
+	return c
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handle registers a handler that returns the endpoint's scripted failures first
+func (s *Server) handle(pattern, endpoint string, h http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if failure, ok := s.nextFailure(endpoint); ok {
+			s.logf("%s %s -> scripted %d", r.Method, r.URL.Path, failure.Status)
+			failure.write(w)
+			return
+		}
+		s.logf("%s %s", r.Method, r.URL.Path)
+		h(w, r)
+	})
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
+
+func (s *Server) handleAuthenticate(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Api-Key") == "" {
+		writeError(w, http.StatusForbidden, "Missing Api-Key")
+		return
+	}
+	email, password, ok := r.BasicAuth()
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	s.mu.Lock()
+	account := s.accounts[email]
+	s.mu.Unlock()
+	if account == nil || account.Password != password {
+		writeError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	s.writeAuthTokens(w, email)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	var req vanmoof.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Refresh tokens are rotated: each one can be used once
+	s.mu.Lock()
+	email, ok := s.refreshTokens[req.RefreshToken]
+	delete(s.refreshTokens, req.RefreshToken)
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	s.writeAuthTokens(w, email)
+}
+
+// writeAuthTokens issues a new auth token and refresh token for email
+func (s *Server) writeAuthTokens(w http.ResponseWriter, email string) {
+	token, err := s.signToken(email, audienceAuth, s.AuthTokenTTL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	refreshToken := rand.Text()
+
+	s.mu.Lock()
+	s.refreshTokens[refreshToken] = email
+	s.mu.Unlock()
+
+	writeJSON(w, vanmoof.AuthResponse{Token: token, RefreshToken: refreshToken})
+}
+
+// handleLogout invalidates all tokens of the account, including its refresh
+// tokens. The real API does not document this endpoint; it is served so that
+// 'cache logout -revoke' can be tried offline.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	account := s.authorize(w, r, audienceAuth)
+	if account == nil {
+		return
+	}
+
+	s.mu.Lock()
+	account.generation++
+	for refreshToken, email := range s.refreshTokens {
+		if email == account.Email {
+			delete(s.refreshTokens, refreshToken)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, struct{}{})
+}
+
+func (s *Server) handleApplicationToken(w http.ResponseWriter, r *http.Request) {
+	account := s.authorize(w, r, audienceAuth)
+	if account == nil {
+		return
+	}
+	token, err := s.signToken(account.Email, audienceApp, s.AppTokenTTL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, vanmoof.AppTokenResponse{Token: token})
+}
+
+func (s *Server) handleCustomerData(w http.ResponseWriter, r *http.Request) {
+	account := s.authorize(w, r, audienceAuth)
+	if account == nil {
+		return
+	}
+	var resp vanmoof.CustomerData
+	resp.Data.UUID = account.UUID
+	resp.Data.Bikes = account.Bikes
+	if resp.Data.Bikes == nil {
+		resp.Data.Bikes = []vanmoof.BikeData{}
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleBikeSharingInvitations(w http.ResponseWriter, r *http.Request) {
+	account := s.authorize(w, r, audienceAuth)
+	if account == nil {
+		return
+	}
+	resp := vanmoof.BikeSharingInvitationsResponse{Invitations: []json.RawMessage{}}
+	for i := 0; i < account.Invitations; i++ {
+		resp.Invitations = append(resp.Invitations, json.RawMessage(fmt.Sprintf(`{"id":%d}`, i+1)))
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleRiderVehicles(w http.ResponseWriter, r *http.Request) {
+	account := s.authorize(w, r, audienceApp)
+	if account == nil {
+		return
+	}
+	if r.PathValue("uuid") != account.UUID {
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+	resp := vanmoof.RiderVehiclesResponse{RiderID: account.UUID, VehicleAccess: account.Shared}
+	if resp.VehicleAccess == nil {
+		resp.VehicleAccess = []vanmoof.VehicleAccess{}
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleCreateCertificate(w http.ResponseWriter, r *http.Request) {
+	account := s.authorize(w, r, audienceApp)
+	if account == nil {
+		return
+	}
+
+	var req vanmoof.CertificateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	pubKey, err := base64.StdEncoding.DecodeString(req.PublicKey)
+	if err != nil || (len(pubKey) != 32 && len(pubKey) != 33) {
+		writeJSON(w, map[string]string{"err": "invalid public key"})
+		return
+	}
+	if len(pubKey) == 33 {
+		pubKey = pubKey[1:]
+	}
+
+	payload, ok := certificatePayload(account, r.PathValue("id"))
+	if !ok {
+		writeJSON(w, map[string]string{"err": "bike not found"})
+		return
+	}
+	payload.Expiry = uint32(time.Now().Add(s.CertificateTTL).Unix())
+	payload.PublicKey = pubKey
+
+	cert, err := s.CA.Issue(payload)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, vanmoof.CertificateResponse{Certificate: base64.StdEncoding.EncodeToString(cert)})
+}
+
+// certificatePayload returns the payload for an owned or shared bike by frame number
+func certificatePayload(account *Account, frameNumber string) (vanmoof.CertificatePayload, bool) {
+	userID, _ := parseUUID(account.UUID)
+	for _, bike := range account.Bikes {
+		if bike.FrameNumber != frameNumber {
+			continue
+		}
+		payload := vanmoof.CertificatePayload{
+			ID:      uint32(bike.BikeID),
+			FrameID: firstNonEmpty(bike.FrameSerial, bike.FrameNumber),
+			BikeID:  firstNonEmpty(bike.MainEcuSerial, bike.FrameNumber),
+			Role:    0x07, // Owner
+			UserID:  userID,
+		}
+		return payload, true
+	}
+	for _, v := range account.Shared {
+		if v.VehicleID != frameNumber {
+			continue
+		}
+		payload := vanmoof.CertificatePayload{
+			FrameID: v.VehicleID,
+			BikeID:  v.VehicleID,
+			Role:    0x0B, // Guest
+			UserID:  userID,
+		}
+		return payload, true
+	}
+	return vanmoof.CertificatePayload{}, false
+}
+
+// authorize checks the bearer token has the given audience and returns its
+// account, or writes a 401 and returns nil
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, audience string) *Account {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(audience), jwt.WithExpirationRequired())
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Invalid token")
+		return nil
+	}
+	email, err := token.Claims.GetSubject()
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Invalid token")
+		return nil
+	}
+
+	s.mu.Lock()
+	account := s.accounts[email]
+	revoked := account != nil && claims.ID != strconv.Itoa(account.generation)
+	s.mu.Unlock()
+	if account == nil {
+		writeError(w, http.StatusUnauthorized, "Unknown account")
+		return nil
+	}
+	if revoked {
+		writeError(w, http.StatusUnauthorized, "Token revoked")
+		return nil
+	}
+	return account
+}
+
+// signToken issues a JWT for email with the given audience and lifetime
+func (s *Server) signToken(email, audience string, ttl time.Duration) (string, error) {
+	s.mu.Lock()
+	var generation int
+	if account := s.accounts[email]; account != nil {
+		generation = account.generation
+	}
+	s.mu.Unlock()
+
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		ID:        strconv.Itoa(generation),
+		Issuer:    "fakeapi",
+		Subject:   email,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// parseUUID decodes a hyphenated UUID into its 16 bytes
+func parseUUID(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 16 {
+		return nil, fmt.Errorf("UUID must be 16 bytes, got %d", len(b))
+	}
+	return b, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,455 @@
+package fakeapi_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"vanmoof-certificates/internal/fakeapi"
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+const (
+	testEmail    = "rider@example.com"
+	testPassword = "password"
+)
+
+// fixture is a fake API with the demo account and a client pointed at it
+type fixture struct {
+	server *fakeapi.Server
+	ca     *vanmoof.TestCA
+	client *vanmoof.Client
+	tokens *vanmoof.MemoryTokenStore
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ca, err := vanmoof.NewTestCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := fakeapi.New(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddAccount(fakeapi.DemoAccount(testEmail, testPassword))
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	tokens := &vanmoof.MemoryTokenStore{}
+	client := fakeapi.NewClient(ts.URL)
+	client.Password = testPassword
+	client.TokenStore = tokens
+	client.Retry = vanmoof.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, MaxElapsed: 10 * time.Second}
+	return &fixture{server: server, ca: ca, client: client, tokens: tokens}
+}
+
+// fail scripts failures for an endpoint
+func (f *fixture) fail(t *testing.T, endpoint string, failures ...fakeapi.Failure) {
+	t.Helper()
+	if err := f.server.Fail(endpoint, failures...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getCerts runs GetCert with JSON output and returns the printed results
+func (f *fixture) getCerts(t *testing.T, bikeFilter string) ([]vanmoof.IssuedCertificate, error) {
+	t.Helper()
+	lines, err := f.getCertLines(t, bikeFilter)
+	var results []vanmoof.IssuedCertificate
+	for _, line := range lines {
+		var result vanmoof.IssuedCertificate
+		if err := json.Unmarshal(line, &result); err != nil {
+			t.Errorf("invalid JSON output %q: %v", line, err)
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, err
+}
+
+// getCertLines runs GetCert with JSON output and returns the printed lines
+func (f *fixture) getCertLines(t *testing.T, bikeFilter string) ([][]byte, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan [][]byte)
+	go func() {
+		var lines [][]byte
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			lines = append(lines, bytes.Clone(scanner.Bytes()))
+		}
+		io.Copy(io.Discard, r)
+		done <- lines
+	}()
+
+	err = f.client.GetCertContext(context.Background(), testEmail, bikeFilter, "", f.ca.TrustStore(), vanmoof.OutputJSON, false)
+	w.Close()
+	return <-done, err
+}
+
+// cachedTokens returns the tokens of the test account in the token store
+func (f *fixture) cachedTokens(t *testing.T) *vanmoof.CachedTokens {
+	t.Helper()
+	cached, err := f.tokens.Load(context.Background(), testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cached
+}
+
+func TestListBikes(t *testing.T) {
+	f := newFixture(t)
+	bikes, err := f.client.ListBikesContext(context.Background(), testEmail, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames []string
+	for _, bike := range bikes {
+		frames = append(frames, bike.FrameNumber)
+	}
+	if got, want := strings.Join(frames, ","), "SVTBKL00063OA,TVSEF300106TA,ASY1234567,TVSEF300207TA"; got != want {
+		t.Errorf("bikes %s, want %s", got, want)
+	}
+	if cached := f.cachedTokens(t); cached == nil || cached.AppToken == "" || cached.RefreshToken == "" {
+		t.Errorf("tokens not cached: %+v", cached)
+	}
+}
+
+func TestGetCert(t *testing.T) {
+	f := newFixture(t)
+	results, err := f.getCerts(t, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d certificates, want 3 (SA5, S6 and the shared S6)", len(results))
+	}
+	for _, result := range results {
+		if result.Certificate == "" || result.Report == nil || !result.Report.Valid() || !result.Report.SignatureVerified {
+			t.Errorf("%s: certificate %q, error %q, report %+v", result.Bike.FrameNumber, result.Certificate, result.Error, result.Report)
+		}
+		if result.PrivateKey == "" {
+			t.Errorf("%s: generated private key missing", result.Bike.FrameNumber)
+		}
+	}
+
+	// Unsupported and unknown bikes
+	if _, err := f.getCerts(t, "1003"); !errors.Is(err, vanmoof.ErrNotSupported) {
+		t.Errorf("unsupported bike: %v, want ErrNotSupported", err)
+	}
+	if _, err := f.getCerts(t, "9999"); !errors.Is(err, vanmoof.ErrBikeNotFound) {
+		t.Errorf("unknown bike: %v, want ErrBikeNotFound", err)
+	}
+}
+
+func TestGetCertJSONLines(t *testing.T) {
+	f := newFixture(t)
+	f.fail(t, fakeapi.EndpointCreateCertificate, fakeapi.ErrorBody("Bike not found"))
+	lines, err := f.getCertLines(t, "all")
+	if !errors.Is(err, vanmoof.ErrPartialFailure) {
+		t.Fatalf("error %v, want ErrPartialFailure", err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want one per bike:\n%s", len(lines), bytes.Join(lines, []byte("\n")))
+	}
+
+	// Key pairs are generated per run, so only the field names are pinned
+	fieldNames := func(data []byte) string {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatalf("invalid JSON %s: %v", data, err)
+		}
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return strings.Join(names, " ")
+	}
+	const (
+		issuedFields      = "bike certificate model private_key public_key report"
+		failedFields      = "bike error model private_key public_key"
+		reportFields      = "bike_id_verified certificate errors expired matched_bike public_key_verified signature_verified signed_by user_id_verified valid warnings"
+		certificateFields = "bike_id certificate expires_at expiry frame_id id public_key role role_name signature user_id"
+		signedByFields    = "key_id label public_key"
+		bikeFields        = "bleProfile frameNumber frameSerial id mainEcuSerial name"
+	)
+	var issued, failed [][]byte
+	for i, line := range lines {
+		switch got := fieldNames(line); got {
+		case issuedFields:
+			issued = append(issued, line)
+		case failedFields:
+			failed = append(failed, line)
+		default:
+			t.Errorf("line %d fields %q, want %q or %q", i+1, got, issuedFields, failedFields)
+		}
+	}
+	if len(issued) != 2 || len(failed) != 1 {
+		t.Fatalf("%d issued and %d failed lines, want 2 and 1", len(issued), len(failed))
+	}
+
+	var first struct {
+		Bike   json.RawMessage `json:"bike"`
+		Report json.RawMessage `json:"report"`
+	}
+	var report struct {
+		Certificate json.RawMessage `json:"certificate"`
+		SignedBy    json.RawMessage `json:"signed_by"`
+	}
+	if err := json.Unmarshal(issued[0], &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(first.Report, &report); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"bike", first.Bike, bikeFields},
+		{"report", first.Report, reportFields},
+		{"certificate", report.Certificate, certificateFields},
+		{"signed_by", report.SignedBy, signedByFields},
+	} {
+		if got := fieldNames(tc.data); got != tc.want {
+			t.Errorf("%s fields %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGetCertSave(t *testing.T) {
+	f := newFixture(t)
+	f.client.CertificateDir = filepath.Join(t.TempDir(), "certificates")
+	results, err := f.getCerts(t, "1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(f.client.CertificateDir, "SVTBKL00063OA-*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("saved files %q, %v", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved vanmoof.IssuedCertificate
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Certificate != results[0].Certificate || saved.PrivateKey != results[0].PrivateKey {
+		t.Errorf("saved %+v, want the printed result %+v", saved, results[0])
+	}
+}
+
+func TestGetCertUntrustedCA(t *testing.T) {
+	f := newFixture(t)
+	other, err := vanmoof.NewTestCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.server.CA = other
+
+	results, err := f.getCerts(t, "1001")
+	if !errors.Is(err, vanmoof.ErrInvalidCertificate) {
+		t.Errorf("err = %v, want ErrInvalidCertificate", err)
+	}
+	if len(results) != 1 || results[0].Report == nil || results[0].Report.SignatureVerified {
+		t.Errorf("results %+v, want one certificate failing signature verification", results)
+	}
+}
+
+func TestWrongPassword(t *testing.T) {
+	f := newFixture(t)
+	f.client.Password = "wrong"
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); !errors.Is(err, vanmoof.ErrUnauthorized) {
+		t.Errorf("err = %v, want ErrUnauthorized", err)
+	}
+	if cached := f.cachedTokens(t); cached != nil {
+		t.Errorf("tokens cached after failed login: %+v", cached)
+	}
+}
+
+func TestCachedTokens(t *testing.T) {
+	f := newFixture(t)
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cached tokens are used without logging in again
+	f.client.Password = "wrong"
+	f.fail(t, fakeapi.EndpointAuthenticate, fakeapi.Unauthorized())
+	if _, err := f.getCerts(t, "1001"); err != nil {
+		t.Fatalf("with cached tokens: %v", err)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	f := newFixture(t)
+	// Tokens expiring within a minute count as expired, so every cached auth
+	// token has to be replaced using the refresh token
+	f.server.AuthTokenTTL = 30 * time.Second
+	f.server.AppTokenTTL = 30 * time.Second
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); err != nil {
+		t.Fatal(err)
+	}
+	first := f.cachedTokens(t)
+
+	f.client.Password = "wrong"
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); err != nil {
+		t.Fatalf("with refresh token: %v", err)
+	}
+	second := f.cachedTokens(t)
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("rotated refresh token not cached")
+	}
+
+	// A rejected refresh token falls back to the password
+	f.fail(t, fakeapi.EndpointToken, fakeapi.Unauthorized())
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); !errors.Is(err, vanmoof.ErrUnauthorized) {
+		t.Errorf("rejected refresh token with wrong password: %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestRevokedToken(t *testing.T) {
+	f := newFixture(t)
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// A token rejected mid-session is renewed once and the request repeated
+	f.fail(t, fakeapi.EndpointCustomerData, fakeapi.Unauthorized())
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); err != nil {
+		t.Fatalf("after one rejection: %v", err)
+	}
+	f.fail(t, fakeapi.EndpointCreateCertificate, fakeapi.Unauthorized())
+	if _, err := f.getCerts(t, "1001"); err != nil {
+		t.Fatalf("after certificate request rejection: %v", err)
+	}
+
+	// A token rejected again after renewal is an error
+	f.fail(t, fakeapi.EndpointCustomerData, fakeapi.Unauthorized(), fakeapi.Unauthorized())
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); !errors.Is(err, vanmoof.ErrUnauthorized) {
+		t.Errorf("after two rejections: %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestScriptedFailures(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		endpoint string
+		failures []fakeapi.Failure
+		wantErr  error // nil: success; errAny: any error
+	}{
+		{"login rate limited once", fakeapi.EndpointAuthenticate, []fakeapi.Failure{fakeapi.RateLimited(0)}, nil},
+		{"login rate limited", fakeapi.EndpointAuthenticate, []fakeapi.Failure{fakeapi.RateLimited(0), fakeapi.RateLimited(0), fakeapi.RateLimited(0)}, vanmoof.ErrRateLimited},
+		{"login reset beyond max elapsed", fakeapi.EndpointAuthenticate, []fakeapi.Failure{fakeapi.RateLimited(time.Hour)}, vanmoof.ErrRateLimited},
+		{"login unauthorized", fakeapi.EndpointAuthenticate, []fakeapi.Failure{fakeapi.Unauthorized()}, vanmoof.ErrUnauthorized},
+		{"login malformed", fakeapi.EndpointAuthenticate, []fakeapi.Failure{fakeapi.MalformedJSON()}, errAny},
+		{"login server error", fakeapi.EndpointAuthenticate, []fakeapi.Failure{fakeapi.ServerError()}, errAny},
+		{"app token malformed", fakeapi.EndpointApplicationToken, []fakeapi.Failure{fakeapi.MalformedJSON()}, errAny},
+		{"customer data server error once", fakeapi.EndpointCustomerData, []fakeapi.Failure{fakeapi.ServerError()}, nil},
+		{"customer data server error", fakeapi.EndpointCustomerData, []fakeapi.Failure{fakeapi.ServerError(), fakeapi.ServerError(), fakeapi.ServerError()}, errAny},
+		{"customer data malformed", fakeapi.EndpointCustomerData, []fakeapi.Failure{fakeapi.MalformedJSON()}, errAny},
+		{"shared vehicles server error", fakeapi.EndpointRiderVehicles, []fakeapi.Failure{fakeapi.ServerError(), fakeapi.ServerError(), fakeapi.ServerError()}, nil},
+		{"invitations server error", fakeapi.EndpointBikeSharingInvitations, []fakeapi.Failure{fakeapi.ServerError(), fakeapi.ServerError(), fakeapi.ServerError()}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.fail(t, tc.endpoint, tc.failures...)
+			_, err := f.getCerts(t, "1001")
+			checkErr(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestScriptedCertificateFailures(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		failures   []fakeapi.Failure
+		bikeFilter string
+		wantErr    error
+		wantIssued int
+	}{
+		// The POST is repeated after 429, which the API sends before processing it
+		{"rate limited once", []fakeapi.Failure{fakeapi.RateLimited(0)}, "1001", nil, 1},
+		// but not after a server error, which may come after a certificate was issued
+		{"server error", []fakeapi.Failure{fakeapi.ServerError()}, "1001", errAny, 0},
+		{"server error with other bikes", []fakeapi.Failure{fakeapi.ServerError()}, "all", vanmoof.ErrPartialFailure, 2},
+		{"error body", []fakeapi.Failure{fakeapi.ErrorBody("refused")}, "1001", errAny, 0},
+		{"malformed", []fakeapi.Failure{fakeapi.MalformedJSON()}, "1001", errAny, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.fail(t, fakeapi.EndpointCreateCertificate, tc.failures...)
+			results, err := f.getCerts(t, tc.bikeFilter)
+			checkErr(t, err, tc.wantErr)
+			issued := 0
+			for _, result := range results {
+				if result.Certificate != "" {
+					issued++
+				} else if result.Error == "" {
+					t.Errorf("%s: neither certificate nor error", result.Bike.FrameNumber)
+				}
+			}
+			if issued != tc.wantIssued {
+				t.Errorf("issued %d certificates, want %d", issued, tc.wantIssued)
+			}
+		})
+	}
+}
+
+// errAny matches any non-nil error in checkErr
+var errAny = errors.New("any error")
+
+func checkErr(t *testing.T, err, want error) {
+	t.Helper()
+	switch {
+	case want == nil && err != nil:
+		t.Errorf("err = %v, want success", err)
+	case want == errAny && err == nil:
+		t.Error("succeeded, want an error")
+	case want != nil && want != errAny && !errors.Is(err, want):
+		t.Errorf("err = %v, want %v", err, want)
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	f := newFixture(t)
+	if err := f.server.ParseScript("getCustomerData=500, getCustomerData=500,getCustomerData=500"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); err == nil {
+		t.Error("succeeded despite scripted failures")
+	}
+	if _, err := f.client.ListBikesContext(context.Background(), testEmail, false); err != nil {
+		t.Errorf("failures not consumed: %v", err)
+	}
+
+	for _, script := range []string{"nope=500", "authenticate=418", "authenticate"} {
+		if err := f.server.ParseScript(script); err == nil {
+			t.Errorf("ParseScript(%q) succeeded", script)
+		}
+	}
+}
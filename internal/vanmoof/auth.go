@@ -2,6 +2,7 @@ package vanmoof
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -9,9 +10,9 @@ import (
 )
 
 // apiHeaders builds common VanMoof API headers with the Api-Key included.
-func apiHeaders(extra map[string]string) map[string]string {
+func (c *Client) apiHeaders(extra map[string]string) map[string]string {
 	headers := map[string]string{
-		"Api-Key": apiKey,
+		"Api-Key": c.APIKey,
 	}
 	for k, v := range extra {
 		headers[k] = v
@@ -19,13 +20,13 @@ func apiHeaders(extra map[string]string) map[string]string {
 	return headers
 }
 
-func authenticate(email, password string, debug bool) (string, string, error) {
+func (c *Client) authenticate(ctx context.Context, email, password string) (string, string, error) {
 	basicAuth := base64.StdEncoding.EncodeToString([]byte(email + ":" + password))
-	headers := apiHeaders(map[string]string{
+	headers := c.apiHeaders(map[string]string{
 		"Authorization": "Basic " + basicAuth,
 	})
 
-	body, err := doHTTPRequest("POST", apiBaseURL+"/authenticate", nil, headers, debug)
+	body, err := c.doHTTPRequest(ctx, "POST", c.APIBaseURL+"/authenticate", nil, headers)
 	if err != nil {
 		return "", "", err
 	}
@@ -38,35 +39,49 @@ func authenticate(email, password string, debug bool) (string, string, error) {
 	return authResp.Token, authResp.RefreshToken, nil
 }
 
-func refreshAuthToken(refreshToken string, debug bool) (string, error) {
+// refreshAuthToken returns a new auth token and, if the API rotated it, a new
+// refresh token. The refresh token is empty if the old one remains valid.
+func (c *Client) refreshAuthToken(ctx context.Context, refreshToken string) (string, string, error) {
 	reqBody, err := json.Marshal(RefreshTokenRequest{RefreshToken: refreshToken})
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	headers := apiHeaders(map[string]string{
+	headers := c.apiHeaders(map[string]string{
 		"Content-Type": "application/json",
 	})
 
-	body, err := doHTTPRequest("POST", apiBaseURL+"/token", bytes.NewBuffer(reqBody), headers, debug)
+	body, err := c.doHTTPRequest(ctx, "POST", c.APIBaseURL+"/token", bytes.NewBuffer(reqBody), headers)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	var resp AuthResponse
 	if err := json.Unmarshal(body, &resp); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return resp.Token, nil
+	return resp.Token, resp.RefreshToken, nil
+}
+
+// logout invalidates the auth token and the tokens derived from it. The
+// endpoint is not part of the documented API and may not exist, so callers
+// must treat failures as harmless.
+func (c *Client) logout(ctx context.Context, authToken string) error {
+	headers := c.apiHeaders(map[string]string{
+		"Authorization": "Bearer " + authToken,
+	})
+
+	_, err := c.doHTTPRequest(ctx, "POST", c.APIBaseURL+"/logout", nil, headers)
+	return err
 }
 
-func getApplicationToken(authToken string, debug bool) (string, error) {
-	headers := apiHeaders(map[string]string{
+func (c *Client) getApplicationToken(ctx context.Context, authToken string) (string, error) {
+	headers := c.apiHeaders(map[string]string{
 		"Authorization": "Bearer " + authToken,
 	})
 
-	body, err := doHTTPRequest("GET", apiBaseURL+"/getApplicationToken", nil, headers, debug)
+	body, err := c.doHTTPRequest(ctx, "GET", c.APIBaseURL+"/getApplicationToken", nil, headers)
 	if err != nil {
 		return "", err
 	}
@@ -77,21 +92,17 @@ func getApplicationToken(authToken string, debug bool) (string, error) {
 	}
 
 	// Validate and decode JWT in debug mode
-	if debug {
-		validateAndShowJWT(appTokenResp.Token)
+	if c.debug() {
+		validateAndShowJWT(c.log(), appTokenResp.Token)
 	}
 
 	return appTokenResp.Token, nil
 }
 
 // getSharedVehicles uses the Vehicle Registry API which does not require the Api-Key header.
-func getSharedVehicles(riderUUID, appToken string, debug bool) ([]VehicleAccess, error) {
-	headers := map[string]string{
-		"Authorization": "Bearer " + appToken,
-	}
-
-	url := fmt.Sprintf(vehicleRegistryBaseURL+"/external/riders/%s/vehicles", url.PathEscape(riderUUID))
-	body, err := doHTTPRequest("GET", url, nil, headers, debug)
+func (c *Client) getSharedVehicles(ctx context.Context, tm *tokenManager, riderUUID string) ([]VehicleAccess, error) {
+	url := fmt.Sprintf(c.VehicleRegistryBaseURL+"/external/riders/%s/vehicles", url.PathEscape(riderUUID))
+	body, err := c.doAuthorizedRequest(ctx, tm, bearerAppToken, "GET", url, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -104,12 +115,8 @@ func getSharedVehicles(riderUUID, appToken string, debug bool) ([]VehicleAccess,
 	return resp.VehicleAccess, nil
 }
 
-func getBikeSharingInvitations(authToken string, debug bool) (int, error) {
-	headers := apiHeaders(map[string]string{
-		"Authorization": "Bearer " + authToken,
-	})
-
-	body, err := doHTTPRequest("GET", apiBaseURL+"/getBikeSharingInvitations", nil, headers, debug)
+func (c *Client) getBikeSharingInvitations(ctx context.Context, tm *tokenManager) (int, error) {
+	body, err := c.doAuthorizedRequest(ctx, tm, bearerAuthToken, "GET", c.APIBaseURL+"/getBikeSharingInvitations", nil, c.apiHeaders(nil))
 	if err != nil {
 		return 0, err
 	}
@@ -122,12 +129,8 @@ func getBikeSharingInvitations(authToken string, debug bool) (int, error) {
 	return len(resp.Invitations), nil
 }
 
-func getCustomerData(authToken string, debug bool) (string, []BikeData, error) {
-	headers := apiHeaders(map[string]string{
-		"Authorization": "Bearer " + authToken,
-	})
-
-	body, err := doHTTPRequest("GET", apiBaseURL+"/getCustomerData?includeBikeDetails", nil, headers, debug)
+func (c *Client) getCustomerData(ctx context.Context, tm *tokenManager) (string, []BikeData, error) {
+	body, err := c.doAuthorizedRequest(ctx, tm, bearerAuthToken, "GET", c.APIBaseURL+"/getCustomerData?includeBikeDetails", nil, c.apiHeaders(nil))
 	if err != nil {
 		return "", nil, err
 	}
@@ -0,0 +1,61 @@
+package vanmoof
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+const bikeCacheFile = "bikes.json"
+
+// LoadBikeCache returns the bikes remembered by BikeCachePath for each
+// account. A missing cache is empty.
+func LoadBikeCache(path string) (map[string][]BikeData, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string][]BikeData{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cacheMap map[string][]BikeData
+	if err := json.Unmarshal(data, &cacheMap); err != nil {
+		return nil, fmt.Errorf("bike cache parse error: %w", err)
+	}
+	if cacheMap == nil {
+		cacheMap = map[string][]BikeData{}
+	}
+	return cacheMap, nil
+}
+
+// saveBikeCache remembers the bikes of email in BikeCachePath, preserving
+// other accounts. The cache is only a convenience, so failures are logged.
+func (c *Client) saveBikeCache(email string, bikes []BikeData) {
+	if c.BikeCachePath == "" {
+		return
+	}
+	if err := updateBikeCache(c.BikeCachePath, email, bikes); err != nil {
+		c.log().Warn("Failed to save bike cache", "error", err)
+		return
+	}
+	c.log().Debug("Bike cache saved", "path", c.BikeCachePath, "count", len(bikes))
+}
+
+// updateBikeCache replaces the bikes of email in the cache at path. It is
+// not locked: when runs race, the last one wins, which a cache can afford.
+func updateBikeCache(path, email string, bikes []BikeData) error {
+	if err := ensureTokenCacheDir(path); err != nil {
+		return err
+	}
+	cacheMap, err := LoadBikeCache(path)
+	if err != nil {
+		cacheMap = map[string][]BikeData{} // Rebuilt from scratch
+	}
+	cacheMap[email] = bikes
+	data, err := json.MarshalIndent(cacheMap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
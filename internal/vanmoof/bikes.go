@@ -1,13 +1,17 @@
 package vanmoof
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
 )
 
-func selectBikes(bikes []BikeData, filter string) ([]BikeData, error) {
+// selectBikes returns the bikes matching filter: 'all', 'ask' to prompt, or
+// comma-separated bike IDs or frame numbers. IDs must match one of bikes;
+// IDs of bikes that are only in all fail with ErrNotSupported, others with
+// ErrBikeNotFound.
+func selectBikes(ctx context.Context, bikes, all []BikeData, filter string) ([]BikeData, error) {
 	if filter == "all" {
 		return bikes, nil
 	}
@@ -15,23 +19,17 @@ func selectBikes(bikes []BikeData, filter string) ([]BikeData, error) {
 	interactive := filter == "ask"
 
 	if interactive {
-		// Display available bikes
-		fmt.Println("\nAvailable SA5 bikes:")
+		// Display available bikes on stderr so stdout stays clean for JSON output
+		fmt.Fprintln(os.Stderr, "\nAvailable SA5 bikes:")
 		for i, bike := range bikes {
-			if bike.BikeID != 0 {
-				fmt.Printf("%d. %s (ID: %d, Frame: %s)\n", i+1, bike.Name, bike.BikeID, bike.FrameNumber)
-			} else {
-				fmt.Printf("%d. %s (Frame: %s)\n", i+1, bike.Name, bike.FrameNumber)
-			}
+			fmt.Fprintf(os.Stderr, "%d. %s\n", i+1, bikeLabel(bike))
 		}
 
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("\nEnter bike numbers to process (comma-separated, or 'all'): ")
-		input, err := reader.ReadString('\n')
+		input, err := readLine(ctx, "\nEnter bike numbers to process (comma-separated, or 'all'): ")
 		if err != nil {
 			return nil, fmt.Errorf("failed to read input: %w", err)
 		}
-		filter = strings.TrimSpace(input)
+		filter = input
 
 		if filter == "all" {
 			return bikes, nil
@@ -59,24 +57,116 @@ func selectBikes(bikes []BikeData, filter string) ([]BikeData, error) {
 			}
 		}
 
-		if isNumeric {
-			// Match by bike API ID
-			for _, bike := range bikes {
-				if bike.BikeID == numericID {
-					selected = append(selected, bike)
-					break
-				}
+		// Match by bike API ID, or by frame number (for shared bikes)
+		matches := func(bike BikeData) bool {
+			if isNumeric {
+				return bike.BikeID == numericID
 			}
-		} else {
-			// Match by frame number (for shared bikes)
-			for _, bike := range bikes {
-				if bike.FrameNumber == part {
-					selected = append(selected, bike)
-					break
-				}
+			return bike.FrameNumber == part
+		}
+
+		found := false
+		for _, bike := range bikes {
+			if matches(bike) {
+				selected = append(selected, bike)
+				found = true
+				break
 			}
 		}
+		if found || interactive {
+			continue
+		}
+		for _, bike := range all {
+			if matches(bike) {
+				return nil, fmt.Errorf("%w: bike %s (%s), only SA5 and S6 bikes are supported", ErrNotSupported, part, BikeModel(bike))
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrBikeNotFound, part)
 	}
 
 	return selected, nil
 }
+
+// bikeLabel describes a bike by name, API ID (if any) and frame number
+func bikeLabel(bike BikeData) string {
+	if bike.BikeID != 0 {
+		return fmt.Sprintf("%s (ID: %d, Frame: %s)", bike.Name, bike.BikeID, bike.FrameNumber)
+	}
+	return fmt.Sprintf("%s (Frame: %s)", bike.Name, bike.FrameNumber)
+}
+
+// IsSupportedBike reports whether certificates can be requested for the bike (SA5/S6)
+func IsSupportedBike(bike BikeData) bool {
+	for _, profile := range supportedBleProfiles {
+		if bike.BleProfile == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// ListBikes authenticates and returns all owned and shared bikes on the account,
+// including bikes that are not supported for certificates
+func (c *Client) ListBikes(email string, noCache bool) ([]BikeData, error) {
+	return c.ListBikesContext(context.Background(), email, noCache)
+}
+
+// ListBikesContext is ListBikes with a context
+func (c *Client) ListBikesContext(ctx context.Context, email string, noCache bool) ([]BikeData, error) {
+	c = c.with()
+	tm, err := c.newTokenManager(ctx, email, noCache)
+	if err != nil {
+		return nil, fmt.Errorf("authentication failed: %w", err)
+	}
+
+	_, bikes, err := c.fetchBikes(ctx, tm)
+	return bikes, err
+}
+
+// fetchBikes returns the customer UUID and the owned bikes merged with bikes
+// shared via the vehicle registry
+func (c *Client) fetchBikes(ctx context.Context, tm *tokenManager) (string, []BikeData, error) {
+	// Get customer data (bikes)
+	customerUUID, bikes, err := c.getCustomerData(ctx, tm)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get customer data: %w", err)
+	}
+
+	c.log().Debug("Retrieved owned bikes", "customer_uuid", customerUUID, "count", len(bikes))
+
+	// Fetch shared bikes from vehicle registry
+	sharedVehicles, err := c.getSharedVehicles(ctx, tm, customerUUID)
+	if ctx.Err() != nil {
+		return "", nil, ctx.Err()
+	} else if err != nil {
+		c.log().Debug("Failed to fetch shared vehicles", "error", err)
+	} else {
+		c.log().Debug("Retrieved shared vehicles", "count", len(sharedVehicles))
+	}
+
+	// Convert shared vehicles to BikeData and merge
+	for _, v := range sharedVehicles {
+		// Skip if we already have this bike as an owned bike
+		alreadyOwned := false
+		for _, b := range bikes {
+			if b.FrameNumber == v.VehicleID {
+				alreadyOwned = true
+				break
+			}
+		}
+		if alreadyOwned {
+			continue
+		}
+
+		bikes = append(bikes, BikeData{
+			Name:        v.Name + " (shared by " + v.OwnerName + ")",
+			FrameNumber: v.VehicleID,
+			BleProfile:  v.BleProfile,
+		})
+	}
+
+	if !tm.noCache {
+		c.saveBikeCache(tm.email, bikes)
+	}
+	return customerUUID, bikes, nil
+}
@@ -0,0 +1,332 @@
+package vanmoof
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Encrypted token cache format, version 1:
+//
+//	magic "VMTC" | version (1 byte) | KDF id (1 byte) | KDF params | salt (16 bytes) | nonce (12 bytes) | ciphertext + GCM tag
+//
+// KDF params are big-endian: PBKDF2-SHA256 has iterations (uint32); Argon2id
+// has time (uint32), memory in KiB (uint32) and threads (1 byte). Everything
+// before the nonce is authenticated as GCM additional data.
+//
+// Legacy files (before version 1) are salt | nonce | ciphertext + GCM tag
+// with PBKDF2-SHA256 at 100,000 iterations.
+const (
+	cacheMagic   = "VMTC"
+	cacheVersion = 1
+
+	kdfPBKDF2   = 1
+	kdfArgon2id = 2
+
+	saltSize  = 16
+	nonceSize = 12
+
+	legacyPBKDF2Iterations = 100_000
+)
+
+// kdfParams are the key derivation parameters stored in the header
+type kdfParams struct {
+	id         byte
+	iterations uint32 // PBKDF2 iterations, or Argon2id time
+	memory     uint32 // Argon2id memory in KiB
+	threads    uint8  // Argon2id parallelism
+}
+
+// defaultKDF is used for new files: Argon2id with the second recommended
+// parameters of RFC 9106 (t=3, m=64 MiB, p=4)
+var defaultKDF = kdfParams{id: kdfArgon2id, iterations: 3, memory: 64 * 1024, threads: 4}
+
+// Bounds for parameters read from files, so a tampered header cannot make
+// key derivation take unbounded time or memory
+const (
+	maxPBKDF2Iterations = 10_000_000
+	maxArgon2Time       = 100
+	maxArgon2Memory     = 1024 * 1024 // 1 GiB
+)
+
+func (p kdfParams) String() string {
+	switch p.id {
+	case kdfPBKDF2:
+		return fmt.Sprintf("PBKDF2-SHA256 (%d iterations)", p.iterations)
+	case kdfArgon2id:
+		return fmt.Sprintf("Argon2id (t=%d, m=%d KiB, p=%d)", p.iterations, p.memory, p.threads)
+	default:
+		return fmt.Sprintf("unknown KDF %d", p.id)
+	}
+}
+
+// deriveKey derives the 32-byte AES key from the passphrase
+func (p kdfParams) deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	switch p.id {
+	case kdfPBKDF2:
+		if p.iterations == 0 || p.iterations > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("invalid PBKDF2 iterations %d", p.iterations)
+		}
+		return pbkdf2.Key([]byte(passphrase), salt, int(p.iterations), 32, sha256.New), nil
+	case kdfArgon2id:
+		if p.iterations == 0 || p.iterations > maxArgon2Time || p.memory == 0 || p.memory > maxArgon2Memory || p.threads == 0 {
+			return nil, fmt.Errorf("invalid Argon2id parameters %s", p)
+		}
+		return argon2.IDKey([]byte(passphrase), salt, p.iterations, p.memory, p.threads, 32), nil
+	default:
+		return nil, fmt.Errorf("unsupported KDF id %d", p.id)
+	}
+}
+
+// appendParams appends the KDF id and params in header format
+func (p kdfParams) appendParams(b []byte) []byte {
+	b = append(b, p.id)
+	b = binary.BigEndian.AppendUint32(b, p.iterations)
+	if p.id == kdfArgon2id {
+		b = binary.BigEndian.AppendUint32(b, p.memory)
+		b = append(b, p.threads)
+	}
+	return b
+}
+
+// parseParams reads the KDF id and params from a header and returns the rest
+func parseParams(b []byte) (kdfParams, []byte, error) {
+	errShort := errors.New("encrypted token cache header too short")
+	if len(b) < 5 {
+		return kdfParams{}, nil, errShort
+	}
+	p := kdfParams{id: b[0], iterations: binary.BigEndian.Uint32(b[1:5])}
+	b = b[5:]
+	switch p.id {
+	case kdfPBKDF2:
+	case kdfArgon2id:
+		if len(b) < 5 {
+			return kdfParams{}, nil, errShort
+		}
+		p.memory = binary.BigEndian.Uint32(b[:4])
+		p.threads = b[4]
+		b = b[5:]
+	default:
+		return kdfParams{}, nil, fmt.Errorf("unsupported KDF id %d", p.id)
+	}
+	return p, b, nil
+}
+
+// isVersionedCache reports whether data starts with the versioned header
+func isVersionedCache(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(cacheMagic))
+}
+
+// cacheKey is an AES key derived from a passphrase with the salt and
+// parameters stored in a file header. Decrypting a file returns its key, so
+// the next save of that file can reuse it instead of running the KDF again;
+// every encryption still uses a fresh random nonce.
+type cacheKey struct {
+	params kdfParams
+	salt   []byte
+	key    []byte
+}
+
+// newCacheKey derives a key from passphrase with defaultKDF and a new salt
+func newCacheKey(passphrase string) (*cacheKey, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := defaultKDF.deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheKey{params: defaultKDF, salt: salt, key: key}, nil
+}
+
+// encrypt encrypts plaintext with AES-256-GCM using k, in the versioned format
+func encrypt(plaintext []byte, k *cacheKey) ([]byte, error) {
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(cacheMagic), cacheVersion)
+	header = k.params.appendParams(header)
+	header = append(header, k.salt...)
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	result := append(bytes.Clone(header), nonce...)
+	return gcm.Seal(result, nonce, plaintext, header), nil
+}
+
+// decrypt decrypts data produced by encrypt, or by the legacy format, and
+// returns the key it was encrypted with. Legacy files return no key.
+func decrypt(data []byte, passphrase string) ([]byte, *cacheKey, error) {
+	if !isVersionedCache(data) {
+		plaintext, err := decryptLegacy(data, passphrase)
+		return plaintext, nil, err
+	}
+
+	rest := data[len(cacheMagic):]
+	if len(rest) < 1 {
+		return nil, nil, errors.New("encrypted token cache header too short")
+	}
+	if rest[0] != cacheVersion {
+		return nil, nil, fmt.Errorf("unsupported token cache version %d", rest[0])
+	}
+	params, rest, err := parseParams(rest[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) < saltSize+nonceSize+aes.BlockSize {
+		return nil, nil, errors.New("encrypted data too short")
+	}
+	salt := rest[:saltSize]
+	nonce := rest[saltSize : saltSize+nonceSize]
+	ciphertext := rest[saltSize+nonceSize:]
+	header := data[:len(data)-len(rest)+saltSize]
+
+	key, err := params.deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plaintext, &cacheKey{params: params, salt: bytes.Clone(salt), key: key}, nil
+}
+
+// decryptLegacy decrypts the format written before the versioned header
+func decryptLegacy(data []byte, passphrase string) ([]byte, error) {
+	if len(data) < saltSize+nonceSize+aes.BlockSize {
+		return nil, errors.New("encrypted data too short")
+	}
+
+	salt := data[:saltSize]
+	nonce := data[saltSize : saltSize+nonceSize]
+	ciphertext := data[saltSize+nonceSize:]
+
+	key := pbkdf2.Key([]byte(passphrase), salt, legacyPBKDF2Iterations, 32, sha256.New)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// newGCM returns AES-256-GCM with the given key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cacheEncryption describes how a token cache file is stored: plaintext, the
+// legacy format or the version and KDF of the versioned format
+func cacheEncryption(data []byte) string {
+	if isVersionedCache(data) {
+		if len(data) > len(cacheMagic) {
+			if params, _, err := parseParams(data[len(cacheMagic)+1:]); err == nil {
+				return fmt.Sprintf("version %d, %s", data[len(cacheMagic)], params)
+			}
+		}
+		return "unknown version"
+	}
+	if json.Valid(data) {
+		return "plaintext"
+	}
+	return fmt.Sprintf("legacy, PBKDF2-SHA256 (%d iterations)", legacyPBKDF2Iterations)
+}
+
+// errPlaintextCache is returned for a plaintext cache file read with a key
+var errPlaintextCache = errors.New("token cache is not encrypted although VANMOOF_CACHE_KEY is set; run 'cache rekey' to encrypt it")
+
+// openCacheData returns the JSON in a token cache file, decrypting it with
+// key. Plaintext JSON is refused when a key is set, as anyone able to write
+// the file could otherwise swap in tokens of their choosing unnoticed; see
+// FileTokenStore.Rekey for encrypting it. The derived key of an encrypted
+// file is returned for sealCacheData.
+func openCacheData(data []byte, key string) ([]byte, *cacheKey, error) {
+	if json.Valid(data) {
+		if key != "" {
+			return nil, nil, errPlaintextCache
+		}
+		return data, nil, nil
+	}
+	if key == "" {
+		if isVersionedCache(data) {
+			return nil, nil, errors.New("token cache is encrypted, set VANMOOF_CACHE_KEY")
+		}
+		return data, nil, nil // Reported as a parse error
+	}
+	plaintext, derived, err := decrypt(data, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("token cache decryption failed: %w", err)
+	}
+	return plaintext, derived, nil
+}
+
+// sealCacheData encrypts JSON for a token cache file if key is set. derived
+// is the key returned by openCacheData for the same passphrase, or nil; it is
+// reused unless it was made with other parameters than defaultKDF.
+func sealCacheData(data []byte, key string, derived *cacheKey) ([]byte, error) {
+	if key == "" {
+		return data, nil
+	}
+	if derived == nil || derived.params != defaultKDF {
+		var err error
+		if derived, err = newCacheKey(key); err != nil {
+			return nil, fmt.Errorf("token cache encryption failed: %w", err)
+		}
+	}
+	encrypted, err := encrypt(data, derived)
+	if err != nil {
+		return nil, fmt.Errorf("token cache encryption failed: %w", err)
+	}
+	return encrypted, nil
+}
+
+// decodeTokenCache parses a token cache file with the tokens of all accounts
+// and returns the key it was encrypted with, if any
+func decodeTokenCache(data []byte, key string) (map[string]CachedTokens, *cacheKey, error) {
+	data, derived, err := openCacheData(data, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cacheMap map[string]CachedTokens
+	if err := json.Unmarshal(data, &cacheMap); err != nil {
+		return nil, nil, fmt.Errorf("token cache parse error: %w", err)
+	}
+	if cacheMap == nil {
+		cacheMap = map[string]CachedTokens{}
+	}
+	return cacheMap, derived, nil
+}
+
+// encodeTokenCache serializes the cache map, encrypted if key is set, see
+// sealCacheData for derived
+func encodeTokenCache(cacheMap map[string]CachedTokens, key string, derived *cacheKey) ([]byte, error) {
+	data, err := json.MarshalIndent(cacheMap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return sealCacheData(data, key, derived)
+}
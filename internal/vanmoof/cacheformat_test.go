@@ -0,0 +1,194 @@
+package vanmoof
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// headerSize is the size of a versioned header with Argon2id, up to and including the salt
+const headerSize = len(cacheMagic) + 1 + 10 + saltSize
+
+func TestSealOpenCacheData(t *testing.T) {
+	useFastKDF(t)
+	plaintext := []byte(`{"a@example.com":{}}`)
+
+	sealed, err := sealCacheData(plaintext, "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isVersionedCache(sealed) {
+		t.Fatal("sealed data has no versioned header")
+	}
+	opened, derived, err := openCacheData(sealed, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("opened %q, want %q", opened, plaintext)
+	}
+	if derived == nil || derived.params != defaultKDF {
+		t.Errorf("derived key = %+v, want params %s", derived, defaultKDF)
+	}
+
+	if _, _, err := openCacheData(sealed, "wrong"); err == nil {
+		t.Error("opened with the wrong key")
+	}
+	if _, _, err := openCacheData(sealed, ""); err == nil {
+		t.Error("opened encrypted data without a key")
+	}
+
+	// The header is authenticated
+	tampered := bytes.Clone(sealed)
+	tampered[len(cacheMagic)+2]++
+	if _, _, err := openCacheData(tampered, "secret"); err == nil {
+		t.Error("opened data with a tampered header")
+	}
+}
+
+func TestOpenLegacyCacheData(t *testing.T) {
+	plaintext := []byte(`{"a@example.com":{}}`)
+	salt := make([]byte, saltSize)
+	nonce := make([]byte, nonceSize)
+	rand.Read(salt)
+	rand.Read(nonce)
+	gcm, err := newGCM(pbkdf2.Key([]byte("secret"), salt, legacyPBKDF2Iterations, 32, sha256.New))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := gcm.Seal(append(bytes.Clone(salt), nonce...), nonce, plaintext, nil)
+
+	opened, derived, err := openCacheData(legacy, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("opened %q, want %q", opened, plaintext)
+	}
+	if derived != nil {
+		t.Error("legacy data returned a reusable key")
+	}
+}
+
+func TestFileTokenStoreReusesDerivedKey(t *testing.T) {
+	useFastKDF(t)
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	ctx := context.Background()
+	s := &FileTokenStore{Path: path, Key: "secret"}
+
+	if err := s.Store(ctx, "a@example.com", testTokens("a@example.com", 0)); err != nil {
+		t.Fatal(err)
+	}
+	first, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store(ctx, "b@example.com", testTokens("b@example.com", 0)); err != nil {
+		t.Fatal(err)
+	}
+	second, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same KDF params and salt, so the key was not derived again, but a new nonce
+	if !bytes.Equal(first[:headerSize], second[:headerSize]) {
+		t.Error("header changed between saves, the key was derived again")
+	}
+	if bytes.Equal(first[headerSize:headerSize+nonceSize], second[headerSize:headerSize+nonceSize]) {
+		t.Error("nonce reused")
+	}
+
+	// A file written with other parameters gets a new key in the default ones
+	old := defaultKDF
+	defaultKDF.iterations++
+	if err := s.Store(ctx, "c@example.com", testTokens("c@example.com", 0)); err != nil {
+		t.Fatal(err)
+	}
+	third, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(second[:headerSize], third[:headerSize]) {
+		t.Error("key reused although the default KDF parameters changed")
+	}
+	defaultKDF = old
+
+	cacheMap, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cacheMap) != 3 {
+		t.Errorf("cache has %d accounts, want 3", len(cacheMap))
+	}
+}
+
+func TestFileTokenStoreRekey(t *testing.T) {
+	useFastKDF(t)
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	ctx := context.Background()
+	s := &FileTokenStore{Path: path}
+
+	if err := s.Store(ctx, "a@example.com", testTokens("a@example.com", 0)); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"one", "two", ""} {
+		if _, err := s.Rekey(key); err != nil {
+			t.Fatalf("Rekey(%q): %v", key, err)
+		}
+		cached, err := (&FileTokenStore{Path: path, Key: key}).Load(ctx, "a@example.com")
+		if err != nil {
+			t.Fatalf("Load after Rekey(%q): %v", key, err)
+		}
+		if cached == nil {
+			t.Fatalf("account lost by Rekey(%q)", key)
+		}
+	}
+}
+
+func TestPlaintextCacheRefusedWithKey(t *testing.T) {
+	useFastKDF(t)
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	ctx := context.Background()
+	if err := (&FileTokenStore{Path: path}).Store(ctx, "a@example.com", testTokens("a@example.com", 0)); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A plaintext file swapped in for an encrypted cache is neither used nor replaced
+	s := &FileTokenStore{Path: path, Key: "secret"}
+	if _, err := s.Load(ctx, "a@example.com"); !errors.Is(err, errPlaintextCache) {
+		t.Errorf("Load = %v, want errPlaintextCache", err)
+	}
+	if err := s.Store(ctx, "b@example.com", testTokens("b@example.com", 0)); !errors.Is(err, errPlaintextCache) {
+		t.Errorf("Store = %v, want errPlaintextCache", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("plaintext cache replaced by Store")
+	}
+	dir := &DirTokenStore{Dir: filepath.Dir(path), Key: "secret"}
+	if err := os.WriteFile(filepath.Join(dir.Dir, "a@example.com.json"), before, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dir.Load(ctx, "a@example.com"); !errors.Is(err, errPlaintextCache) {
+		t.Errorf("DirTokenStore.Load = %v, want errPlaintextCache", err)
+	}
+
+	// Rekey encrypts it with the key already set
+	if _, err := s.Rekey("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := s.Load(ctx, "a@example.com"); err != nil || cached == nil {
+		t.Errorf("Load after Rekey = %+v, %v", cached, err)
+	}
+}
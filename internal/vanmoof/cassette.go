@@ -0,0 +1,197 @@
+package vanmoof
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Interaction is one recorded HTTP request/response pair, with secrets redacted
+type Interaction struct {
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status int         `json:"status"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body"`
+	} `json:"response"`
+}
+
+// RecordTransport forwards requests and writes each interaction to a numbered
+// JSON file in Dir, with tokens, passwords and emails redacted
+type RecordTransport struct {
+	Dir  string
+	Next http.RoundTripper // nil uses http.DefaultTransport
+
+	mu sync.Mutex
+	n  int
+}
+
+// NewRecordTransport creates dir and returns a transport recording into it
+func NewRecordTransport(dir string, next http.RoundTripper) (*RecordTransport, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	return &RecordTransport{Dir: dir, Next: next}, nil
+}
+
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	var in Interaction
+	in.Request.Method = req.Method
+	in.Request.URL = RedactSecrets(req.URL.String())
+	in.Request.Header = redactHeader(req.Header)
+	in.Request.Body = RedactSecrets(string(reqBody))
+	in.Response.Status = resp.StatusCode
+	in.Response.Header = redactHeader(resp.Header)
+	in.Response.Body = RedactSecrets(string(respBody))
+
+	if err := t.save(req, in); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// save writes the interaction as <n>-<method>-<endpoint>.json
+func (t *RecordTransport) save(req *http.Request, in Interaction) error {
+	data, err := json.MarshalIndent(in, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.n++
+	name := fmt.Sprintf("%03d-%s-%s.json", t.n, req.Method, path.Base(req.URL.Path))
+	t.mu.Unlock()
+
+	if err := os.WriteFile(filepath.Join(t.Dir, name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// ReplayTransport answers requests from a recorded cassette without network
+// access. Each request is served by the first unused interaction with the
+// same method, path and query; the host is ignored.
+type ReplayTransport struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewReplayTransport loads all interactions from dir in file name order
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no interactions found in cassette %s", dir)
+	}
+	sort.Strings(files)
+
+	t := &ReplayTransport{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var in Interaction
+		if err := json.Unmarshal(data, &in); err != nil {
+			return nil, fmt.Errorf("invalid cassette file %s: %w", file, err)
+		}
+		t.interactions = append(t.interactions, in)
+	}
+	t.used = make([]bool, len(t.interactions))
+	return t, nil
+}
+
+// PublicKey returns the public key of the first recorded certificate request,
+// or "" if there is none. The recorded certificates are only valid for it.
+func (t *ReplayTransport) PublicKey() string {
+	for _, in := range t.interactions {
+		if in.Request.Method != http.MethodPost || !strings.HasSuffix(in.Request.URL, "/create_certificate") {
+			continue
+		}
+		var req CertificateRequest
+		if err := json.Unmarshal([]byte(in.Request.Body), &req); err == nil && req.PublicKey != "" {
+			return req.PublicKey
+		}
+	}
+	return ""
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	want := req.Method + " " + req.URL.RequestURI()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, in := range t.interactions {
+		if t.used[i] {
+			continue
+		}
+		recorded, err := http.NewRequest(in.Request.Method, in.Request.URL, nil)
+		if err != nil || in.Request.Method+" "+recorded.URL.RequestURI() != want {
+			continue
+		}
+		t.used[i] = true
+
+		header := in.Response.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette has no unused interaction for %s", want)
+}
@@ -10,64 +10,83 @@ import (
 	"github.com/fxamacker/cbor/v2"
 )
 
-func ProcessCertificate(certStr, expectedPubKeyStr, bikeID, expectedUserID string, bikes []BikeData, debug bool) {
-	if certStr == "" {
-		fmt.Println("Error: Certificate string is empty")
-		return
-	}
-
-	certData, err := base64.StdEncoding.DecodeString(certStr)
+// minCertificateSize is the 64-byte signature plus the smallest plausible CBOR payload
+const minCertificateSize = 134
+
+// ProcessCertificate parses a base64 certificate, verifies it against opts and
+// prints the result in the given output format (OutputText or OutputJSON).
+// It returns the error of the report, see VerifyReport.Err; in text mode a
+// certificate that cannot be decoded is only returned, not printed.
+func ProcessCertificate(certStr string, opts VerifyOptions, output string, debug bool) error {
+	report, err := CheckCertificate(certStr, opts)
 	if err != nil {
-		fmt.Println("Error decoding certificate:", err)
-		return
+		if output == OutputJSON {
+			printJSON(errorJSON{Error: err.Error()})
+		}
+		return err
 	}
 
-	if len(certData) < 134 {
-		fmt.Println("Error: Certificate is too short")
-		return
+	if output == OutputJSON {
+		printJSON(report)
+	} else {
+		printReport(report, opts, debug)
 	}
+	return report.Err()
+}
 
-	// Parse certificate into result struct
-	r := parseCertificate(certData, bikes)
+// CheckCertificate decodes a base64 certificate and verifies it against opts.
+// Certificates that cannot be decoded return an error wrapping
+// ErrInvalidCertificate; verification problems are in the report.
+func CheckCertificate(certStr string, opts VerifyOptions) (*VerifyReport, error) {
+	if certStr == "" {
+		return nil, fmt.Errorf("%w: certificate string is empty", ErrInvalidCertificate)
+	}
 
-	// Cross-reference verifications
-	verifyBikeID(&r, bikeID, bikes)
-	verifyPublicKey(&r, expectedPubKeyStr)
-	verifyUserID(&r, expectedUserID)
+	certData, err := base64.StdEncoding.DecodeString(certStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding certificate: %w", ErrInvalidCertificate, err)
+	}
 
-	// Silently verify the certificate signature against known CA keys.
-	// Only surfaces an error when the signature does NOT match a known key.
-	if verified, hasKeys := verifyCertificateSignature(r.signature, certData[64:]); hasKeys && !verified {
-		r.errors = append(r.errors, "Signature INVALID: does not verify against any known VanMoof CA key")
+	cert, err := ParseCertificate(certData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
 	}
+	return cert.Verify(opts), nil
+}
 
-	// Output
+// printReport prints a verification report in text form
+func printReport(r *VerifyReport, opts VerifyOptions, debug bool) {
 	if debug {
-		printVerbose(r, certData, expectedPubKeyStr, bikeID, expectedUserID, bikes)
-		validateCertificateSignature(r.signature, certData[64:], debug)
+		printVerbose(r, opts)
+		validateCertificateSignature(r.Certificate.Signature, r.Certificate.Payload, opts.trustStore(), opts.now(), debug)
 	} else {
 		printCompact(r)
 	}
 }
 
-// parseCertificate extracts and validates all fields from raw certificate bytes
-func parseCertificate(certData []byte, bikes []BikeData) certResult {
-	r := certResult{
-		signature: certData[0:64],
+// ParseCertificate decodes raw certificate bytes ([64-byte signature][CBOR payload]).
+// It only fails when the data cannot be decoded at all; missing or mistyped
+// fields are recorded and surfaced as errors by Verify.
+func ParseCertificate(certData []byte) (*Certificate, error) {
+	if len(certData) < minCertificateSize {
+		return nil, fmt.Errorf("certificate is too short (%d bytes, expected at least %d)", len(certData), minCertificateSize)
 	}
 
-	cborPayload := certData[64:]
+	c := &Certificate{
+		Raw:       certData,
+		Signature: certData[0:64],
+		Payload:   certData[64:],
+	}
 
 	var rawMap map[interface{}]interface{}
-	if err := cbor.Unmarshal(cborPayload, &rawMap); err != nil {
-		r.errors = append(r.errors, fmt.Sprintf("CBOR parse error: %v", err))
-		return r
+	if err := cbor.Unmarshal(c.Payload, &rawMap); err != nil {
+		return nil, fmt.Errorf("CBOR parse error: %w", err)
 	}
 
 	// Check required fields
 	for _, field := range []string{"i", "f", "b", "e", "r", "u", "p"} {
 		if _, exists := rawMap[field]; !exists {
-			r.errors = append(r.errors, fmt.Sprintf("Missing required field: '%s'", field))
+			c.fieldErrors = append(c.fieldErrors, fmt.Sprintf("Missing required field: '%s'", field))
 		}
 	}
 
@@ -80,119 +99,200 @@ func parseCertificate(certData []byte, bikes []BikeData) certResult {
 		switch keyStr {
 		case "i":
 			if v, ok := value.(uint64); ok {
-				r.apiID = uint32(v)
+				c.ID = uint32(v)
 			} else {
-				r.errors = append(r.errors, "Field 'i' has incorrect type (expected uint)")
+				c.fieldErrors = append(c.fieldErrors, "Field 'i' has incorrect type (expected uint)")
 			}
 		case "f":
 			if v, ok := value.(string); ok {
-				r.frameID = []byte(v)
+				c.FrameID = v
 			} else {
-				r.errors = append(r.errors, "Field 'f' has incorrect type (expected string)")
+				c.fieldErrors = append(c.fieldErrors, "Field 'f' has incorrect type (expected string)")
 			}
 		case "b":
 			if v, ok := value.(string); ok {
-				r.bikeID = []byte(v)
+				c.BikeID = v
 			} else {
-				r.errors = append(r.errors, "Field 'b' has incorrect type (expected string)")
+				c.fieldErrors = append(c.fieldErrors, "Field 'b' has incorrect type (expected string)")
 			}
 		case "e":
 			if v, ok := value.(uint64); ok {
-				r.expiry = uint32(v)
+				c.Expiry = uint32(v)
 			} else {
-				r.errors = append(r.errors, "Field 'e' has incorrect type (expected uint)")
+				c.fieldErrors = append(c.fieldErrors, "Field 'e' has incorrect type (expected uint)")
 			}
 		case "r":
 			if v, ok := value.(uint64); ok {
-				r.role = uint8(v)
+				c.Role = uint8(v)
 			} else {
-				r.errors = append(r.errors, "Field 'r' has incorrect type (expected uint)")
+				c.fieldErrors = append(c.fieldErrors, "Field 'r' has incorrect type (expected uint)")
 			}
 		case "u":
 			if v, ok := value.([]byte); ok {
-				r.userID = v
+				c.UserID = v
 				if len(v) != 16 {
-					r.errors = append(r.errors, fmt.Sprintf("Field 'u' has incorrect length (expected 16 bytes, got %d)", len(v)))
+					c.fieldErrors = append(c.fieldErrors, fmt.Sprintf("Field 'u' has incorrect length (expected 16 bytes, got %d)", len(v)))
 				}
 			} else {
-				r.errors = append(r.errors, "Field 'u' has incorrect type (expected bytes)")
+				c.fieldErrors = append(c.fieldErrors, "Field 'u' has incorrect type (expected bytes)")
 			}
 		case "p":
 			if v, ok := value.([]byte); ok {
-				r.publicKey = v
+				c.PublicKey = v
 				if len(v) != 32 {
-					r.errors = append(r.errors, fmt.Sprintf("Field 'p' has incorrect length (expected 32 bytes, got %d)", len(v)))
+					c.fieldErrors = append(c.fieldErrors, fmt.Sprintf("Field 'p' has incorrect length (expected 32 bytes, got %d)", len(v)))
 				}
 			} else {
-				r.errors = append(r.errors, "Field 'p' has incorrect type (expected bytes)")
+				c.fieldErrors = append(c.fieldErrors, "Field 'p' has incorrect type (expected bytes)")
 			}
 		}
 	}
 
+	return c, nil
+}
+
+// ExpiryTime returns the certificate expiry as a time.Time
+func (c *Certificate) ExpiryTime() time.Time {
+	return time.Unix(int64(c.Expiry), 0)
+}
+
+// RoleDescription returns a human-readable description of the certificate role
+func (c *Certificate) RoleDescription() string {
+	return getRoleDescription(c.Role)
+}
+
+// UserUUID returns the user ID in standard hyphenated UUID format
+func (c *Certificate) UserUUID() string {
+	return formatUUID(c.UserID)
+}
+
+// trustStore returns the trust store to verify signatures against
+func (o VerifyOptions) trustStore() *TrustStore {
+	if o.TrustStore != nil {
+		return o.TrustStore
+	}
+	return DefaultTrustStore()
+}
+
+// now returns the reference time for validity checks
+func (o VerifyOptions) now() time.Time {
+	if o.Now.IsZero() {
+		return time.Now()
+	}
+	return o.Now
+}
+
+// Valid reports whether verification found no errors (warnings are allowed)
+func (r *VerifyReport) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Err returns nil if the report has no errors. A certificate whose only
+// error is its expiry returns an error wrapping ErrCertificateExpired, any
+// other error one wrapping ErrInvalidCertificate.
+func (r *VerifyReport) Err() error {
+	switch {
+	case r.Valid():
+		return nil
+	case r.Expired && len(r.Errors) == 1:
+		return fmt.Errorf("%w: %s", ErrCertificateExpired, r.Errors[0])
+	case len(r.Errors) == 1:
+		return fmt.Errorf("%w: %s", ErrInvalidCertificate, r.Errors[0])
+	default:
+		return fmt.Errorf("%w: %s (and %d more errors)", ErrInvalidCertificate, r.Errors[0], len(r.Errors)-1)
+	}
+}
+
+// Verify validates the certificate fields and signature and cross-references
+// them against the expectations in opts. It never prints anything.
+func (c *Certificate) Verify(opts VerifyOptions) *VerifyReport {
+	r := &VerifyReport{Certificate: c}
+	r.Errors = append(r.Errors, c.fieldErrors...)
+
 	// Validate frame ID format
-	if len(r.frameID) == 0 {
-		r.errors = append(r.errors, "Frame ID (f) is empty")
-	} else if !ValidateFrameNumber(string(r.frameID)) {
-		r.warnings = append(r.warnings, fmt.Sprintf("Frame ID (f) has invalid format: %s", string(r.frameID)))
+	if c.FrameID == "" {
+		r.Errors = append(r.Errors, "Frame ID (f) is empty")
+	} else if !ValidateFrameNumber(c.FrameID) {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Frame ID (f) has invalid format: %s", c.FrameID))
 	}
 
 	// Validate bike ID format
-	if len(r.bikeID) == 0 {
-		r.errors = append(r.errors, "Bike ID (b) is empty")
-	} else if !ValidateFrameNumber(string(r.bikeID)) {
-		r.warnings = append(r.warnings, fmt.Sprintf("Bike ID (b) has invalid format: %s", string(r.bikeID)))
+	if c.BikeID == "" {
+		r.Errors = append(r.Errors, "Bike ID (b) is empty")
+	} else if !ValidateFrameNumber(c.BikeID) {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Bike ID (b) has invalid format: %s", c.BikeID))
 	}
 
 	// Validate expiry
-	now := time.Now().Unix()
-	if r.expiry == 0 {
-		r.errors = append(r.errors, "Expiry timestamp is zero")
-	} else if int64(r.expiry) < now {
-		r.errors = append(r.errors, fmt.Sprintf("Certificate has EXPIRED (expired %s ago)", time.Since(time.Unix(int64(r.expiry), 0)).Round(time.Second)))
-	} else if int64(r.expiry) > now+365*24*60*60 {
-		r.warnings = append(r.warnings, fmt.Sprintf("Certificate expiry is suspiciously far in the future (%.1f days)", float64(int64(r.expiry)-now)/86400))
+	nowTime := opts.now()
+	now := nowTime.Unix()
+	if c.Expiry == 0 {
+		r.Errors = append(r.Errors, "Expiry timestamp is zero")
+	} else if int64(c.Expiry) < now {
+		r.Expired = true
+		r.Errors = append(r.Errors, fmt.Sprintf("Certificate has EXPIRED (expired %s ago)", nowTime.Sub(c.ExpiryTime()).Round(time.Second)))
+	} else if int64(c.Expiry) > now+365*24*60*60 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Certificate expiry is suspiciously far in the future (%.1f days)", float64(int64(c.Expiry)-now)/86400))
 	}
 
 	// Validate role
 	validRoles := []uint8{0x00, 0x01, 0x03, 0x07, 0x0F, 0x0B}
 	roleValid := false
 	for _, validRole := range validRoles {
-		if r.role == validRole {
+		if c.Role == validRole {
 			roleValid = true
 			break
 		}
 	}
 	if !roleValid {
-		r.warnings = append(r.warnings, fmt.Sprintf("Unknown role value: 0x%02X", r.role))
+		r.Warnings = append(r.Warnings, fmt.Sprintf("Unknown role value: 0x%02X", c.Role))
 	}
 
 	// Validate UUID
-	if len(r.userID) == 16 && !validateUUID(r.userID) {
-		r.warnings = append(r.warnings, "User UUID has invalid version or variant")
+	if len(c.UserID) == 16 && !validateUUID(c.UserID) {
+		r.Warnings = append(r.Warnings, "User UUID has invalid version or variant")
 	}
 
 	// Match against API bikes
-	frameIDStr := string(r.frameID)
-	bikeIDStr := string(r.bikeID)
-	for i, bike := range bikes {
-		if (frameIDStr != "" && (bike.FrameNumber == frameIDStr || bike.FrameSerial == frameIDStr)) ||
-			(bikeIDStr != "" && (bike.FrameNumber == bikeIDStr || bike.FrameSerial == bikeIDStr || bike.MainEcuSerial == bikeIDStr)) {
-			r.matchedBike = &bikes[i]
+	for i, bike := range opts.Bikes {
+		if (c.FrameID != "" && (bike.FrameNumber == c.FrameID || bike.FrameSerial == c.FrameID)) ||
+			(c.BikeID != "" && (bike.FrameNumber == c.BikeID || bike.FrameSerial == c.BikeID || bike.MainEcuSerial == c.BikeID)) {
+			r.MatchedBike = &opts.Bikes[i]
 			break
 		}
 	}
 
+	// Cross-reference verifications
+	verifyBikeID(r, opts.BikeID, opts.Bikes)
+	verifyPublicKey(r, opts.PublicKey)
+	verifyUserID(r, opts.UserID)
+
+	// Verify the certificate signature against the trusted CA keys.
+	// Only surfaces an error when the signature does NOT match a trusted key,
+	// or the matching key is revoked or outside its validity window.
+	signer, hasKeys := verifyCertificateSignature(c.Signature, c.Payload, opts.trustStore())
+	r.SignedBy = signer
+	if signer != nil {
+		if err := signer.checkValidity(nowTime); err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("Signature not trusted: %v", err))
+		} else {
+			r.SignatureVerified = true
+		}
+	} else if hasKeys {
+		r.Errors = append(r.Errors, "Signature INVALID: does not verify against any trusted CA key")
+	}
+
 	return r
 }
 
 // verifyBikeID checks the certificate against the expected bike ID
-func verifyBikeID(r *certResult, bikeID string, bikes []BikeData) {
+func verifyBikeID(r *VerifyReport, bikeID string, bikes []BikeData) {
 	if bikeID == "" {
 		return
 	}
 
-	frameIDStr := string(r.frameID)
-	bikeIDStr := string(r.bikeID)
+	frameIDStr := r.Certificate.FrameID
+	bikeIDStr := r.Certificate.BikeID
 
 	var parsedNumericID uint32
 	isNumeric := false
@@ -205,124 +305,121 @@ func verifyBikeID(r *certResult, bikeID string, bikes []BikeData) {
 			if bike.BikeID == int(parsedNumericID) {
 				if (frameIDStr == bike.FrameNumber || frameIDStr == bike.FrameSerial) &&
 					(bikeIDStr == bike.FrameNumber || bikeIDStr == bike.FrameSerial || bikeIDStr == bike.MainEcuSerial) {
-					r.bikeIDVerified = true
+					r.BikeIDVerified = true
 				}
 				return
 			}
 		}
-		r.errors = append(r.errors, fmt.Sprintf("Bike ID %d not found in your account", parsedNumericID))
+		r.Errors = append(r.Errors, fmt.Sprintf("Bike ID %d not found in your account", parsedNumericID))
 	} else if !isNumeric {
 		if frameIDStr == bikeID || bikeIDStr == bikeID {
-			r.bikeIDVerified = true
+			r.BikeIDVerified = true
 		} else {
-			r.errors = append(r.errors, fmt.Sprintf("Bike frame %s not found in certificate (AFM: %s, ABM: %s)", bikeID, frameIDStr, bikeIDStr))
+			r.Errors = append(r.Errors, fmt.Sprintf("Bike frame %s not found in certificate (AFM: %s, ABM: %s)", bikeID, frameIDStr, bikeIDStr))
 		}
 	}
 }
 
 // verifyPublicKey checks the embedded public key against the expected key
-func verifyPublicKey(r *certResult, expectedPubKeyStr string) {
+func verifyPublicKey(r *VerifyReport, expectedPubKeyStr string) {
 	if expectedPubKeyStr == "" {
 		return
 	}
 	pubKeyData, err := base64.StdEncoding.DecodeString(expectedPubKeyStr)
 	if err != nil {
-		r.errors = append(r.errors, "Error decoding expected public key")
+		r.Errors = append(r.Errors, "Error decoding expected public key")
 		return
 	}
 	if len(pubKeyData) < 32 {
-		r.errors = append(r.errors, fmt.Sprintf("Public key too short: expected at least 32 bytes, got %d", len(pubKeyData)))
+		r.Errors = append(r.Errors, fmt.Sprintf("Public key too short: expected at least 32 bytes, got %d", len(pubKeyData)))
 		return
 	}
-	if bytes.Equal(r.publicKey, pubKeyData[len(pubKeyData)-32:]) {
-		r.pubKeyVerified = true
+	if bytes.Equal(r.Certificate.PublicKey, pubKeyData[len(pubKeyData)-32:]) {
+		r.PubKeyVerified = true
 	} else {
-		r.errors = append(r.errors, "Public key mismatch: certificate key does not match provided key")
+		r.Errors = append(r.Errors, "Public key mismatch: certificate key does not match provided key")
 	}
 }
 
 // verifyUserID checks the certificate user ID against the expected UUID
-func verifyUserID(r *certResult, expectedUserID string) {
+func verifyUserID(r *VerifyReport, expectedUserID string) {
 	if expectedUserID == "" {
 		return
 	}
-	certUserID := fmt.Sprintf("%x", r.userID)
+	certUserID := fmt.Sprintf("%x", r.Certificate.UserID)
 	expectedClean := strings.ToLower(strings.ReplaceAll(expectedUserID, "-", ""))
 	if certUserID == expectedClean {
-		r.userIDVerified = true
+		r.UserIDVerified = true
 	} else {
-		r.errors = append(r.errors, fmt.Sprintf("User ID mismatch: expected %s, certificate has %s", expectedUserID, certUserID))
+		r.Errors = append(r.Errors, fmt.Sprintf("User ID mismatch: expected %s, certificate has %s", expectedUserID, certUserID))
 	}
 }
 
 // printCompact prints a one-line summary (normal mode)
-func printCompact(r certResult) {
-	frameIDStr := string(r.frameID)
-	expiryTime := time.Unix(int64(r.expiry), 0)
-	accessLevel := getRoleDescription(r.role)
-
-	if len(r.errors) == 0 {
-		parts := []string{frameIDStr, accessLevel, "expires " + expiryTime.Format("2006-01-02 15:04:05 MST")}
-		if r.matchedBike != nil {
+func printCompact(r *VerifyReport) {
+	c := r.Certificate
+
+	if r.Valid() {
+		parts := []string{c.FrameID, c.RoleDescription(), "expires " + c.ExpiryTime().Format("2006-01-02 15:04:05 MST")}
+		if r.MatchedBike != nil {
 			parts = append(parts, "bike matched")
 		}
-		if r.pubKeyVerified {
+		if r.PubKeyVerified {
 			parts = append(parts, "pubkey ok")
 		}
-		if r.userIDVerified {
+		if r.UserIDVerified {
 			parts = append(parts, "user ok")
 		}
 		fmt.Printf("Certificate valid: %s\n", strings.Join(parts, ", "))
 	} else {
-		fmt.Printf("Certificate INVALID: %d error(s), %d warning(s)\n", len(r.errors), len(r.warnings))
-		for _, e := range r.errors {
+		fmt.Printf("Certificate INVALID: %d error(s), %d warning(s)\n", len(r.Errors), len(r.Warnings))
+		for _, e := range r.Errors {
 			fmt.Printf("  ✗ %s\n", e)
 		}
-		for _, w := range r.warnings {
+		for _, w := range r.Warnings {
 			fmt.Printf("  ⚠ %s\n", w)
 		}
 	}
 }
 
 // printVerbose prints the full detailed output (debug mode)
-func printVerbose(r certResult, certData []byte, expectedPubKeyStr, bikeID, expectedUserID string, bikes []BikeData) {
-	fmt.Printf("Total Certificate Length: %d bytes\n", len(certData))
-	fmt.Printf("Decoded Certificate (hex): %x\n", certData)
+func printVerbose(r *VerifyReport, opts VerifyOptions) {
+	c := r.Certificate
 
-	signature := certData[0:64]
-	cborPayload := certData[64:]
+	fmt.Printf("Total Certificate Length: %d bytes\n", len(c.Raw))
+	fmt.Printf("Decoded Certificate (hex): %x\n", c.Raw)
 
-	signatureBase64 := base64.StdEncoding.EncodeToString(signature)
+	signatureBase64 := base64.StdEncoding.EncodeToString(c.Signature)
 	fmt.Printf("\n--- Extracted from Certificate ---\n")
 	fmt.Printf("Signature (Base64): %s\n", signatureBase64)
-	fmt.Printf("Signature (hex): %x\n", signature)
-	fmt.Printf("CBOR Payload length: %d bytes\n", len(cborPayload))
-	fmt.Printf("CBOR Payload (hex): %x\n", cborPayload)
+	fmt.Printf("Signature (hex): %x\n", c.Signature)
+	fmt.Printf("CBOR Payload length: %d bytes\n", len(c.Payload))
+	fmt.Printf("CBOR Payload (hex): %x\n", c.Payload)
 
 	fmt.Println("\n[DEBUG] Signature Analysis:")
-	fmt.Printf("  Signature is %d bytes (Ed25519 signature)\n", len(signature))
-	fmt.Printf("  R component (first 32 bytes): %x\n", signature[:32])
-	fmt.Printf("  S component (last 32 bytes):  %x\n", signature[32:])
+	fmt.Printf("  Signature is %d bytes (Ed25519 signature)\n", len(c.Signature))
+	fmt.Printf("  R component (first 32 bytes): %x\n", c.Signature[:32])
+	fmt.Printf("  S component (last 32 bytes):  %x\n", c.Signature[32:])
 
 	// Validation summary
 	fmt.Println("\n--- Certificate Validation ---")
-	if len(r.errors) == 0 && len(r.warnings) == 0 {
+	if len(r.Errors) == 0 && len(r.Warnings) == 0 {
 		fmt.Printf("✓ Certificate structure is valid\n")
 	} else {
-		for _, e := range r.errors {
+		for _, e := range r.Errors {
 			fmt.Printf("✗ %s\n", e)
 		}
-		for _, w := range r.warnings {
+		for _, w := range r.Warnings {
 			fmt.Printf("⚠ %s\n", w)
 		}
 	}
 
 	// Parsed fields
-	fmt.Printf("Certificate ID: %d\n", r.apiID)
+	fmt.Printf("Certificate ID: %d\n", c.ID)
 
-	frameIDStr := string(r.frameID)
+	frameIDStr := c.FrameID
 	fmt.Printf("AFM (Authorized Frame Module): %s", frameIDStr)
-	if r.matchedBike != nil && (r.matchedBike.FrameNumber == frameIDStr || r.matchedBike.FrameSerial == frameIDStr) {
+	if r.MatchedBike != nil && (r.MatchedBike.FrameNumber == frameIDStr || r.MatchedBike.FrameSerial == frameIDStr) {
 		fmt.Printf(" ✓ Valid (matches API bike)\n")
 	} else if ValidateFrameNumber(frameIDStr) {
 		fmt.Printf(" ✓ Valid format\n")
@@ -332,9 +429,9 @@ func printVerbose(r certResult, certData []byte, expectedPubKeyStr, bikeID, expe
 		fmt.Println()
 	}
 
-	bikeIDStr := string(r.bikeID)
+	bikeIDStr := c.BikeID
 	fmt.Printf("ABM (Authorized Bike Module): %s", bikeIDStr)
-	if r.matchedBike != nil && (r.matchedBike.FrameNumber == bikeIDStr || r.matchedBike.FrameSerial == bikeIDStr || r.matchedBike.MainEcuSerial == bikeIDStr) {
+	if r.MatchedBike != nil && (r.MatchedBike.FrameNumber == bikeIDStr || r.MatchedBike.FrameSerial == bikeIDStr || r.MatchedBike.MainEcuSerial == bikeIDStr) {
 		fmt.Printf(" ✓ Valid (matches API bike)\n")
 	} else if ValidateFrameNumber(bikeIDStr) {
 		fmt.Printf(" ✓ Valid format\n")
@@ -344,37 +441,35 @@ func printVerbose(r certResult, certData []byte, expectedPubKeyStr, bikeID, expe
 		fmt.Println()
 	}
 
-	expiryTime := time.Unix(int64(r.expiry), 0)
-	fmt.Printf("Certificate Expiry: %s (Unix: %d)\n", expiryTime.Format("2006-01-02 15:04:05 MST"), r.expiry)
-	fmt.Printf("Access Level: %s\n", getRoleDescription(r.role))
+	fmt.Printf("Certificate Expiry: %s (Unix: %d)\n", c.ExpiryTime().Format("2006-01-02 15:04:05 MST"), c.Expiry)
+	fmt.Printf("Access Level: %s\n", c.RoleDescription())
 
-	userUUIDStr := formatUUID(r.userID)
-	fmt.Printf("User ID: %s", userUUIDStr)
-	if validateUUID(r.userID) {
-		fmt.Printf(" ✓ Valid UUID v%d\n", getUUIDVersion(r.userID))
+	fmt.Printf("User ID: %s", c.UserUUID())
+	if validateUUID(c.UserID) {
+		fmt.Printf(" ✓ Valid UUID v%d\n", getUUIDVersion(c.UserID))
 	} else {
 		fmt.Printf(" ✗ Invalid UUID\n")
 	}
 
-	embeddedPubKeyBase64 := base64.StdEncoding.EncodeToString(r.publicKey)
+	embeddedPubKeyBase64 := base64.StdEncoding.EncodeToString(c.PublicKey)
 	fmt.Printf("Embedded Public Key (Base64): %s\n", embeddedPubKeyBase64)
 
 	// Bike match summary
-	if len(bikes) > 0 {
+	if len(opts.Bikes) > 0 {
 		fmt.Println("\n--- Certificate Validation Summary ---")
-		if r.matchedBike != nil {
+		if r.MatchedBike != nil {
 			fmt.Printf("✓ Certificate is VALID for your bike\n")
-			if r.matchedBike.BikeID != 0 {
-				fmt.Printf("  Matched Bike ID: %d\n", r.matchedBike.BikeID)
+			if r.MatchedBike.BikeID != 0 {
+				fmt.Printf("  Matched Bike ID: %d\n", r.MatchedBike.BikeID)
 			}
-			fmt.Printf("  Bike Name: %s\n", r.matchedBike.Name)
-			fmt.Printf("  Frame Number: %s\n", r.matchedBike.FrameNumber)
+			fmt.Printf("  Bike Name: %s\n", r.MatchedBike.Name)
+			fmt.Printf("  Frame Number: %s\n", r.MatchedBike.FrameNumber)
 		} else {
 			fmt.Printf("✗ Certificate does NOT match any of your bikes\n")
 			fmt.Printf("  Certificate AFM: %s\n", frameIDStr)
 			fmt.Printf("  Certificate ABM: %s\n", bikeIDStr)
 			fmt.Printf("  Your bikes: ")
-			for i, bike := range bikes {
+			for i, bike := range opts.Bikes {
 				if i > 0 {
 					fmt.Printf(", ")
 				}
@@ -389,22 +484,22 @@ func printVerbose(r certResult, certData []byte, expectedPubKeyStr, bikeID, expe
 	}
 
 	// Bike ID verification
-	if bikeID != "" {
+	if opts.BikeID != "" {
 		fmt.Println("\n--- Bike ID Verification ---")
-		if r.bikeIDVerified {
-			fmt.Printf("✓ Bike ID Verified: %s\n", bikeID)
-			if r.matchedBike != nil {
+		if r.BikeIDVerified {
+			fmt.Printf("✓ Bike ID Verified: %s\n", opts.BikeID)
+			if r.MatchedBike != nil {
 				fmt.Printf("  Certificate matches bike from your account\n")
 			}
 		} else {
-			fmt.Printf("✗ Bike ID verification failed for: %s\n", bikeID)
+			fmt.Printf("✗ Bike ID verification failed for: %s\n", opts.BikeID)
 		}
 	}
 
 	// Public key verification
-	if expectedPubKeyStr != "" {
+	if opts.PublicKey != "" {
 		fmt.Println("\n--- Public Key Verification ---")
-		if r.pubKeyVerified {
+		if r.PubKeyVerified {
 			fmt.Println("✓ Success: Public Key matches the Certificate signature.")
 		} else {
 			fmt.Println("✗ Warning: Key mismatch detected.")
@@ -412,14 +507,14 @@ func printVerbose(r certResult, certData []byte, expectedPubKeyStr, bikeID, expe
 	}
 
 	// User ID verification
-	if expectedUserID != "" {
+	if opts.UserID != "" {
 		fmt.Println("\n--- User ID Verification ---")
-		if r.userIDVerified {
-			fmt.Printf("✓ User ID Verified: %s\n", expectedUserID)
+		if r.UserIDVerified {
+			fmt.Printf("✓ User ID Verified: %s\n", opts.UserID)
 		} else {
 			fmt.Printf("✗ User ID mismatch\n")
-			fmt.Printf("  Expected: %s\n", expectedUserID)
-			fmt.Printf("  Certificate: %s\n", fmt.Sprintf("%x", r.userID))
+			fmt.Printf("  Expected: %s\n", opts.UserID)
+			fmt.Printf("  Certificate: %s\n", fmt.Sprintf("%x", c.UserID))
 		}
 	}
 }
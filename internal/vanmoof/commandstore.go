@@ -0,0 +1,106 @@
+package vanmoof
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CommandTokenStore delegates token storage to an external helper program,
+// for example a wrapper around a team's secret manager. The helper is run
+// with the operation as its last argument and a JSON object on stdin:
+//
+//	get    {"email": "..."}; prints the tokens, or nothing if there are none
+//	store  {"email": "...", "auth_token": "...", "app_token": "...", "refresh_token": "..."}
+//	erase  {"email": "..."}
+//	list   {}; prints an object mapping every email to its tokens
+//
+// The tokens printed by get and list use the same fields as store. A
+// non-zero exit status is an error, reported with what the helper wrote to
+// stderr. Helpers without list work for everything but listing and purging.
+type CommandTokenStore struct {
+	Command []string // Program and its arguments
+}
+
+// commandStoreRequest is the JSON object a helper reads from stdin
+type commandStoreRequest struct {
+	Email string `json:"email"`
+	*CachedTokens
+}
+
+// Load returns the stored tokens of email, or nil if there are none
+func (s *CommandTokenStore) Load(ctx context.Context, email string) (*CachedTokens, error) {
+	out, err := s.run(ctx, "get", commandStoreRequest{Email: email})
+	if err != nil || len(bytes.TrimSpace(out)) == 0 {
+		return nil, err
+	}
+	var tokens CachedTokens
+	if err := json.Unmarshal(out, &tokens); err != nil {
+		return nil, fmt.Errorf("token store command: invalid get output: %w", err)
+	}
+	if tokens == (CachedTokens{}) {
+		return nil, nil
+	}
+	return &tokens, nil
+}
+
+// Store saves the tokens of email
+func (s *CommandTokenStore) Store(ctx context.Context, email string, tokens CachedTokens) error {
+	_, err := s.run(ctx, "store", commandStoreRequest{Email: email, CachedTokens: &tokens})
+	return err
+}
+
+// Erase removes the tokens of email
+func (s *CommandTokenStore) Erase(ctx context.Context, email string) error {
+	_, err := s.run(ctx, "erase", commandStoreRequest{Email: email})
+	return err
+}
+
+// List returns the stored tokens of all accounts
+func (s *CommandTokenStore) List(ctx context.Context) (map[string]CachedTokens, error) {
+	out, err := s.run(ctx, "list", struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	cacheMap := make(map[string]CachedTokens)
+	if len(bytes.TrimSpace(out)) == 0 {
+		return cacheMap, nil
+	}
+	if err := json.Unmarshal(out, &cacheMap); err != nil {
+		return nil, fmt.Errorf("token store command: invalid list output: %w", err)
+	}
+	return cacheMap, nil
+}
+
+// Purge erases the accounts returned by list one by one and returns their tokens
+func (s *CommandTokenStore) Purge(ctx context.Context) (map[string]CachedTokens, error) {
+	return purgeListed(ctx, s)
+}
+
+// run runs the helper for one operation and returns its stdout
+func (s *CommandTokenStore) run(ctx context.Context, op string, req any) ([]byte, error) {
+	if len(s.Command) == 0 {
+		return nil, errors.New("token store command not set")
+	}
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, s.Command[0], append(s.Command[1:], op)...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("token store command %s failed: %w: %s", op, err, msg)
+		}
+		return nil, fmt.Errorf("token store command %s failed: %w", op, err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,188 @@
+package vanmoof
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// CredentialHelper obtains passwords from an external helper speaking the
+// git-credential protocol, so password managers and git credential helpers
+// (e.g. "git credential-libsecret") can be used. The helper is run with get,
+// store or erase as its last argument and reads key=value lines from stdin:
+//
+//	protocol=https
+//	host=api.vanmoof-api.com
+//	username=<email>
+//	password=<password>   (store and erase only)
+//
+// For get it prints key=value lines including password=, or nothing if it has
+// no password. A non-zero exit status is an error.
+type CredentialHelper struct {
+	Command []string // Program and its arguments
+}
+
+// credential identifies the account a password is for
+type credential struct {
+	protocol string
+	host     string // With the port, if any
+	username string
+}
+
+// hostname returns the host without the port
+func (cred credential) hostname() string {
+	if host, _, err := net.SplitHostPort(cred.host); err == nil {
+		return host
+	}
+	return cred.host
+}
+
+// get returns the password of cred, or "" if the helper has none
+func (h *CredentialHelper) get(ctx context.Context, cred credential) (string, error) {
+	out, err := h.run(ctx, "get", cred, "")
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if password, ok := strings.CutPrefix(scanner.Text(), "password="); ok {
+			return password, nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// store saves a password that was accepted by the API
+func (h *CredentialHelper) store(ctx context.Context, cred credential, password string) error {
+	_, err := h.run(ctx, "store", cred, password)
+	return err
+}
+
+// erase removes a password that was rejected by the API
+func (h *CredentialHelper) erase(ctx context.Context, cred credential, password string) error {
+	_, err := h.run(ctx, "erase", cred, password)
+	return err
+}
+
+// run runs the helper for one operation and returns its stdout
+func (h *CredentialHelper) run(ctx context.Context, op string, cred credential, password string) ([]byte, error) {
+	if len(h.Command) == 0 {
+		return nil, errors.New("credential helper not set")
+	}
+	var input strings.Builder
+	fmt.Fprintf(&input, "protocol=%s\nhost=%s\nusername=%s\n", cred.protocol, cred.host, cred.username)
+	if password != "" {
+		fmt.Fprintf(&input, "password=%s\n", password)
+	}
+	input.WriteString("\n")
+
+	cmd := exec.CommandContext(ctx, h.Command[0], append(h.Command[1:], op)...)
+	cmd.Stdin = strings.NewReader(input.String())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("credential helper %s failed: %w: %s", op, err, msg)
+		}
+		return nil, fmt.Errorf("credential helper %s failed: %w", op, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// DefaultNetrcPath returns $NETRC, or ~/.netrc (~/_netrc on Windows)
+func DefaultNetrcPath() (string, error) {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc"), nil
+	}
+	return filepath.Join(home, ".netrc"), nil
+}
+
+// netrcPassword returns the password for login on host from a netrc file, or
+// "" if the file does not exist or has no matching entry. A machine entry
+// without login matches any login; the default entry matches any host.
+func netrcPassword(path, host, login string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	type entry struct {
+		machine, login, password string
+		isDefault                bool
+	}
+	var entries []entry
+	var current *entry
+
+	// macdef bodies run until an empty line, so they are skipped line by line
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			value := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+			switch fields[j] {
+			case "machine":
+				entries = append(entries, entry{machine: value()})
+				current = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, entry{isDefault: true})
+				current = &entries[len(entries)-1]
+			case "login":
+				if v := value(); current != nil {
+					current.login = v
+				}
+			case "password":
+				if v := value(); current != nil {
+					current.password = v
+				}
+			case "account":
+				value()
+			case "macdef":
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+
+	for _, e := range entries {
+		if (e.isDefault || e.machine == host) && (e.login == "" || e.login == login) && e.password != "" {
+			return e.password, nil
+		}
+	}
+	return "", nil
+}
+
+// apiCredential returns the credential identifying the password of email for the API
+func (c *Client) apiCredential(email string) credential {
+	cred := credential{protocol: "https", host: "api.vanmoof-api.com", username: email}
+	if u, err := url.Parse(c.APIBaseURL); err == nil && u.Host != "" {
+		cred.protocol, cred.host = u.Scheme, u.Host
+	}
+	return cred
+}
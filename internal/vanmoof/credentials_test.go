@@ -0,0 +1,188 @@
+package vanmoof
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Environment of the helper process run by the CredentialHelper under test
+const helperCredentialEnv = "VANMOOF_TEST_HELPER_CREDENTIAL"
+
+func TestNetrcPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	netrc := `# Comments and unknown tokens are ignored
+machine other.example.com login a@example.com password other
+machine api.example.com
+    login a@example.com
+    password first
+machine api.example.com login b@example.com account acct password second
+
+macdef init
+machine api.example.com login c@example.com password from-macro
+password from-macro
+
+machine api.example.com password any-login
+default login d@example.com password fallback
+`
+	if err := os.WriteFile(path, []byte(strings.ReplaceAll(netrc, "\n", "\r\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		host, login, want string
+	}{
+		{"api.example.com", "a@example.com", "first"},
+		{"api.example.com", "b@example.com", "second"},
+		{"api.example.com", "c@example.com", "any-login"}, // Not the macro body
+		{"other.example.com", "a@example.com", "other"},
+		{"other.example.com", "d@example.com", "fallback"},
+		{"unknown.example.com", "d@example.com", "fallback"},
+		{"unknown.example.com", "e@example.com", ""},
+	} {
+		got, err := netrcPassword(path, tc.host, tc.login)
+		if err != nil || got != tc.want {
+			t.Errorf("netrcPassword(%s, %s) = %q, %v; want %q", tc.host, tc.login, got, err, tc.want)
+		}
+	}
+
+	if got, err := netrcPassword(filepath.Join(t.TempDir(), "missing"), "api.example.com", "a@example.com"); got != "" || err != nil {
+		t.Errorf("missing file: %q, %v", got, err)
+	}
+}
+
+// newTestCredentialHelper returns a helper process keeping one password in
+// a file, and the file it logs its operations and input to
+func newTestCredentialHelper(t *testing.T) (*CredentialHelper, string) {
+	dir := t.TempDir()
+	t.Setenv(helperCredentialEnv, filepath.Join(dir, "password"))
+	return &CredentialHelper{Command: []string{os.Args[0], "-test.run=^TestHelperCredential$", "--"}}, filepath.Join(dir, "password.log")
+}
+
+func TestCredentialHelper(t *testing.T) {
+	h, logPath := newTestCredentialHelper(t)
+	ctx := context.Background()
+	cred := (&Client{APIBaseURL: "http://127.0.0.1:8080/v8"}).apiCredential("rider@example.com")
+
+	if password, err := h.get(ctx, cred); err != nil || password != "" {
+		t.Fatalf("get before store = %q, %v", password, err)
+	}
+	if err := h.store(ctx, cred, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := h.get(ctx, cred); err != nil || password != "s3cret" {
+		t.Errorf("get after store = %q, %v", password, err)
+	}
+	if err := h.erase(ctx, cred, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := h.get(ctx, cred); err != nil || password != "" {
+		t.Errorf("get after erase = %q, %v", password, err)
+	}
+
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "get protocol=http host=127.0.0.1:8080 username=rider@example.com\n" +
+		"store protocol=http host=127.0.0.1:8080 username=rider@example.com password=s3cret\n" +
+		"get protocol=http host=127.0.0.1:8080 username=rider@example.com\n" +
+		"erase protocol=http host=127.0.0.1:8080 username=rider@example.com password=s3cret\n" +
+		"get protocol=http host=127.0.0.1:8080 username=rider@example.com\n"
+	if string(log) != want {
+		t.Errorf("helper input:\n%s\nwant:\n%s", log, want)
+	}
+
+	// Failures report the exit status and stderr
+	cred.username = "fail"
+	if _, err := h.get(ctx, cred); err == nil || !strings.Contains(err.Error(), "helper refused") {
+		t.Errorf("failing get = %v, want the helper's message", err)
+	}
+}
+
+func TestResolvePasswordOrder(t *testing.T) {
+	t.Setenv("VANMOOF_PASSWORD", "")
+	h, _ := newTestCredentialHelper(t)
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(netrc, []byte("machine api.example.com login rider@example.com password from-netrc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{APIBaseURL: "https://api.example.com/v8", CredentialHelper: h, NetrcPath: netrc}
+	ctx := context.Background()
+	cred := c.apiCredential("rider@example.com")
+
+	for _, tc := range []struct {
+		name   string
+		setup  func()
+		want   string
+		source passwordSource
+	}{
+		{"netrc without a helper password", func() {}, "from-netrc", passwordNetrc},
+		{"helper before netrc", func() { h.store(ctx, cred, "from-helper") }, "from-helper", passwordHelper},
+		{"environment first", func() { t.Setenv("VANMOOF_PASSWORD", "from-env") }, "from-env", passwordGiven},
+	} {
+		tc.setup()
+		password, source, err := c.resolvePassword(ctx, "rider@example.com", "")
+		if err != nil || password != tc.want || source != tc.source {
+			t.Errorf("%s: %q from %d, %v; want %q from %d", tc.name, password, source, err, tc.want, tc.source)
+		}
+	}
+}
+
+// TestHelperCredential is run by the CredentialHelper of
+// newTestCredentialHelper, keeping the password in the file named by
+// helperCredentialEnv
+func TestHelperCredential(t *testing.T) {
+	path := os.Getenv(helperCredentialEnv)
+	if path == "" {
+		t.Skip("helper process")
+	}
+	if err := runHelperCredential(path, os.Args[len(os.Args)-1]); err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(1)
+	}
+	os.Exit(0) // Keep the test output off stdout
+}
+
+func runHelperCredential(path, op string) error {
+	var fields []string
+	input := make(map[string]string)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() && scanner.Text() != "" {
+		fields = append(fields, scanner.Text())
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		input[key] = value
+	}
+	if input["username"] == "fail" {
+		return errors.New("helper refused")
+	}
+	log, err := os.OpenFile(path+".log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	fmt.Fprintf(log, "%s %s\n", op, strings.Join(fields, " "))
+
+	switch op {
+	case "get":
+		password, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("protocol=%s\nhost=%s\nusername=%s\npassword=%s\n", input["protocol"], input["host"], input["username"], password)
+		return nil
+	case "store":
+		return os.WriteFile(path, []byte(input["password"]), 0600)
+	case "erase":
+		return os.Remove(path)
+	}
+	return errors.New("unknown operation " + op)
+}
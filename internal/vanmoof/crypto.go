@@ -1,12 +1,14 @@
 package vanmoof
 
 import (
-	"bytes"
+	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 )
 
@@ -22,26 +24,37 @@ func GenerateED25519() (string, string, error) {
 	return privKeyB64, pubKeyB64, nil
 }
 
-func createCertificate(bikeID, pubKey, appToken string, debug bool) (string, error) {
+// createCertificate requests a certificate for the bike and returns it along
+// with the raw response body. A response with an "err" field is returned as *APIError.
+func (c *Client) createCertificate(ctx context.Context, tm *tokenManager, bikeID, pubKey string) (string, []byte, error) {
 	certReq := CertificateRequest{
 		PublicKey: pubKey,
 	}
 
 	reqBody, err := json.Marshal(certReq)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	headers := map[string]string{
-		"Authorization": "Bearer " + appToken,
-		"Content-Type":  "application/json",
+		"Content-Type": "application/json",
 	}
 
-	url := fmt.Sprintf(bikeApiBaseURL+"/bikes/%s/create_certificate", url.PathEscape(bikeID))
-	body, err := doHTTPRequest("POST", url, bytes.NewBuffer(reqBody), headers, debug)
+	url := fmt.Sprintf(c.BikeAPIBaseURL+"/bikes/%s/create_certificate", url.PathEscape(bikeID))
+	body, err := c.doAuthorizedRequest(ctx, tm, bearerAppToken, "POST", url, reqBody, headers)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	return string(body), nil
+	var resp CertificateResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", body, fmt.Errorf("failed to parse certificate response: %w", err)
+	}
+	if len(resp.Err) > 0 {
+		return "", body, newAPIError("POST", url, http.StatusOK, nil, body)
+	}
+	if resp.Certificate == "" {
+		return "", body, errors.New("certificate response missing 'certificate' field")
+	}
+	return resp.Certificate, body, nil
 }
@@ -0,0 +1,191 @@
+package vanmoof
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const dirStoreSuffix = ".json"
+
+// DirTokenStore keeps the tokens of each account in a file of its own in
+// Dir, named after the lower-cased email, in the same format as
+// FileTokenStore. Files are replaced atomically and accounts never share one,
+// so no lock is needed.
+type DirTokenStore struct {
+	Dir string
+	Key string // Encrypts the files; empty stores plain JSON
+}
+
+// accountFile returns the path of the file holding the tokens of email. The
+// email is lower-cased, so that emails differing only in case, which are the
+// same account, share a file on every file system.
+func (s *DirTokenStore) accountFile(email string) (string, error) {
+	if s.Dir == "" {
+		return "", errors.New("token store directory not set")
+	}
+	if email == "" {
+		return "", errors.New("email required")
+	}
+	return filepath.Join(s.Dir, escapeAccountName(strings.ToLower(email))+dirStoreSuffix), nil
+}
+
+// legacyAccountFile returns the path earlier versions used for email, which
+// kept its case
+func (s *DirTokenStore) legacyAccountFile(email string) string {
+	return filepath.Join(s.Dir, escapeAccountName(email)+dirStoreSuffix)
+}
+
+// Load returns the stored tokens of email, or nil if there are none
+func (s *DirTokenStore) Load(ctx context.Context, email string) (*CachedTokens, error) {
+	path, err := s.accountFile(email)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.readFile(path)
+	if tokens == nil && err == nil {
+		return s.readFile(s.legacyAccountFile(email))
+	}
+	return tokens, err
+}
+
+// Store saves the tokens of email
+func (s *DirTokenStore) Store(ctx context.Context, email string, tokens CachedTokens) error {
+	path, err := s.accountFile(email)
+	if err != nil {
+		return err
+	}
+	if err := ensureTokenCacheDir(path); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if data, err = sealCacheData(data, s.Key, nil); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+	return nil
+}
+
+// Erase removes the tokens of email
+func (s *DirTokenStore) Erase(ctx context.Context, email string) error {
+	path, err := s.accountFile(email)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{path, s.legacyAccountFile(email)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the stored tokens of all accounts. A missing directory is empty.
+func (s *DirTokenStore) List(ctx context.Context) (map[string]CachedTokens, error) {
+	files, err := s.accountFiles()
+	if err != nil {
+		return nil, err
+	}
+	cacheMap := make(map[string]CachedTokens)
+	for email, path := range files {
+		tokens, err := s.readFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		if tokens != nil {
+			cacheMap[email] = *tokens
+		}
+	}
+	return cacheMap, nil
+}
+
+// Purge deletes the files of all accounts and returns their tokens. Files
+// that cannot be read, for example because the key was lost, are deleted as
+// well and their tokens are not returned.
+func (s *DirTokenStore) Purge(ctx context.Context) (map[string]CachedTokens, error) {
+	files, err := s.accountFiles()
+	if err != nil {
+		return nil, err
+	}
+	cacheMap := make(map[string]CachedTokens)
+	for email, path := range files {
+		if tokens, err := s.readFile(path); err == nil && tokens != nil {
+			cacheMap[email] = *tokens
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return cacheMap, nil
+}
+
+// accountFiles returns the paths of the account files in Dir, keyed by email
+func (s *DirTokenStore) accountFiles() (map[string]string, error) {
+	if s.Dir == "" {
+		return nil, errors.New("token store directory not set")
+	}
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), dirStoreSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		email, err := url.PathUnescape(name)
+		if err != nil {
+			continue // Not written by this store
+		}
+		files[email] = filepath.Join(s.Dir, entry.Name())
+	}
+	return files, nil
+}
+
+// readFile reads the tokens in an account file, or nil if it does not exist
+func (s *DirTokenStore) readFile(path string) (*CachedTokens, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if data, _, err = openCacheData(data, s.Key); err != nil {
+		return nil, err
+	}
+	var tokens CachedTokens
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("token cache parse error: %w", err)
+	}
+	return &tokens, nil
+}
+
+// escapeAccountName makes an email safe to use as a file name on every
+// platform by percent-encoding everything but letters, digits and "@._+-"
+func escapeAccountName(email string) string {
+	var b strings.Builder
+	for i := 0; i < len(email); i++ {
+		c := email[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("@._+-", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package vanmoof
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// MarshalCertificatePayload encodes a payload exactly like VanMoof does: a
+// 7-entry map in i/f/b/e/r/u/p order with i and e as fixed-width uint32
+// (0x1a) and r in its shortest form. Field values are not validated so that
+// malformed payloads can be produced.
+func MarshalCertificatePayload(payload CertificatePayload) ([]byte, error) {
+	// The default encoder keeps struct declaration order; raw messages are
+	// written verbatim, other integers use the shortest serialization.
+	data, err := cbor.Marshal(wirePayload{
+		ID:        fixedUint32(payload.ID),
+		FrameID:   payload.FrameID,
+		BikeID:    payload.BikeID,
+		Expiry:    fixedUint32(payload.Expiry),
+		Role:      payload.Role,
+		UserID:    payload.UserID,
+		PublicKey: payload.PublicKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("CBOR encode error: %w", err)
+	}
+	return data, nil
+}
+
+// wirePayload is CertificatePayload with the integer widths of VanMoof certificates
+type wirePayload struct {
+	ID        cbor.RawMessage `cbor:"i"`
+	FrameID   string          `cbor:"f"`
+	BikeID    string          `cbor:"b"`
+	Expiry    cbor.RawMessage `cbor:"e"`
+	Role      uint8           `cbor:"r"`
+	UserID    []byte          `cbor:"u"`
+	PublicKey []byte          `cbor:"p"`
+}
+
+// fixedUint32 encodes v as a CBOR uint32 (major type 0, additional info 26)
+// even if a shorter encoding exists
+func fixedUint32(v uint32) cbor.RawMessage {
+	return binary.BigEndian.AppendUint32([]byte{0x1a}, v)
+}
+
+// EncodeCertificate builds a signed certificate in the wire format
+// [64-byte Ed25519 signature][CBOR payload]. The signer must produce Ed25519
+// signatures, e.g. an ed25519.PrivateKey.
+func EncodeCertificate(payload CertificatePayload, signer crypto.Signer) ([]byte, error) {
+	data, err := MarshalCertificatePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ed25519 signs the message itself, so no pre-hashing (crypto.Hash(0))
+	signature, err := signer.Sign(rand.Reader, data, crypto.Hash(0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+	if len(signature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("signer returned %d-byte signature, expected %d (Ed25519)", len(signature), ed25519.SignatureSize)
+	}
+
+	cert := make([]byte, 0, len(signature)+len(data))
+	cert = append(cert, signature...)
+	cert = append(cert, data...)
+	return cert, nil
+}
+
+// CertificatePayload returns the decoded fields of the certificate, suitable
+// for re-encoding with EncodeCertificate.
+func (c *Certificate) CertificatePayload() CertificatePayload {
+	return CertificatePayload{
+		ID:        c.ID,
+		FrameID:   c.FrameID,
+		BikeID:    c.BikeID,
+		Expiry:    c.Expiry,
+		Role:      c.Role,
+		UserID:    c.UserID,
+		PublicKey: c.PublicKey,
+	}
+}
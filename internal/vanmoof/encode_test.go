@@ -0,0 +1,87 @@
+package vanmoof
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fixtureKey signed testdata/certificate.b64, a certificate encoded byte by
+// byte as described in the README: i and e as uint32 (0x1a), r as a one-byte
+// uint, text strings and byte strings in i/f/b/e/r/u/p order
+func fixtureKey() ed25519.PrivateKey {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// readFixture returns the raw bytes of testdata/certificate.b64
+func readFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/certificate.b64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestCertificateRoundTrip(t *testing.T) {
+	raw := readFixture(t)
+	key := fixtureKey()
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), raw[64:], raw[:64]) {
+		t.Fatal("fixture signature does not verify")
+	}
+
+	cert, err := ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.ID != 1337 || cert.FrameID != "SVTBKL00063OA" || cert.Expiry != 1767668550 || cert.Role != 7 {
+		t.Errorf("parsed %+v", cert.CertificatePayload())
+	}
+
+	encoded, err := EncodeCertificate(cert.CertificatePayload(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Fatalf("re-encoded certificate differs\n got %x\nwant %x", encoded, raw)
+	}
+
+	reparsed, err := ParseCertificate(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reparsed.Payload, cert.Payload) {
+		t.Error("payload changed after parse, encode, parse")
+	}
+}
+
+func TestMarshalCertificatePayloadIntegerWidths(t *testing.T) {
+	data, err := MarshalCertificatePayload(CertificatePayload{ID: 1, Expiry: 2, Role: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"61691a00000001", // "i": uint32 even for small values
+		"61651a00000002", // "e": uint32
+		"617207",         // "r": shortest form
+	} {
+		if !strings.Contains(hex.EncodeToString(data), want) {
+			t.Errorf("payload %x does not contain %s", data, want)
+		}
+	}
+	if data[0] != 0xa7 {
+		t.Errorf("payload starts with %#x, want a 7-entry map (0xa7)", data[0])
+	}
+}
@@ -0,0 +1,149 @@
+package vanmoof
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel errors for use with errors.Is. API failures match them through
+// APIError.Is; bike selection, certificate verification and GetCert return
+// them wrapped.
+var (
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrRateLimited        = errors.New("rate limited")
+	ErrBikeNotFound       = errors.New("bike not found")
+	ErrNotSupported       = errors.New("not supported")
+	ErrInvalidCertificate = errors.New("invalid certificate")
+	ErrCertificateExpired = errors.New("certificate expired")
+	ErrPartialFailure     = errors.New("partial failure")
+)
+
+// RateLimit is the rate limit state reported by the x-ratelimit-* headers
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// APIError is an error response from a VanMoof API: an HTTP status >= 400,
+// or a successful status with an {"err": ...} body as the bike API sends
+type APIError struct {
+	StatusCode int
+	Endpoint   string     // Request method and URL path, e.g. "POST /v8/authenticate"
+	Code       string     // VanMoof error code, if the response has one
+	Message    string     // VanMoof error message, or the (truncated) response body
+	RateLimit  *RateLimit // nil if the response has no rate limit headers
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if e.Code != "" {
+		msg = fmt.Sprintf("%s (code %s)", msg, e.Code)
+	}
+	if e.StatusCode >= 400 {
+		return fmt.Sprintf("%s: HTTP %d: %s", e.Endpoint, e.StatusCode, msg)
+	}
+	return fmt.Sprintf("%s: %s", e.Endpoint, msg)
+}
+
+// Is maps the error onto the sentinel errors. Bike errors are recognised by
+// status 404/501 or, for the {"err": ...} bodies of the bike API, by message.
+func (e *APIError) Is(target error) bool {
+	message := strings.ToLower(e.Message)
+	bikeEndpoint := strings.Contains(e.Endpoint, "/bikes/")
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrBikeNotFound:
+		return bikeEndpoint && (e.StatusCode == http.StatusNotFound || strings.Contains(message, "not found"))
+	case ErrNotSupported:
+		return e.StatusCode == http.StatusNotImplemented || (bikeEndpoint && strings.Contains(message, "not supported"))
+	}
+	return false
+}
+
+// newAPIError builds an APIError from a response, extracting the VanMoof
+// error code and message from JSON bodies when present
+func newAPIError(method, rawURL string, status int, header http.Header, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: status,
+		Endpoint:   method + " " + rawURL,
+		RateLimit:  parseRateLimit(header),
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		e.Endpoint = method + " " + u.Path
+	}
+
+	e.Code, e.Message = parseErrorBody(body)
+	if e.Message == "" {
+		e.Message = string(body)
+		if len(e.Message) > 500 {
+			e.Message = e.Message[:500] + "... (truncated)"
+		}
+	}
+	return e
+}
+
+// parseErrorBody extracts the error code and message from the JSON error
+// formats of the VanMoof APIs: {"err": ...}, {"error": ...}, {"message": ...}
+func parseErrorBody(body []byte) (code, message string) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", ""
+	}
+
+	for _, key := range []string{"code", "error_code", "errorCode"} {
+		if code = jsonScalar(fields[key]); code != "" {
+			break
+		}
+	}
+	for _, key := range []string{"err", "error", "message", "error_description"} {
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		if message = jsonScalar(raw); message != "" {
+			return code, message
+		}
+		// Nested error object, e.g. {"err": {"code": ..., "message": ...}}
+		if nestedCode, nestedMessage := parseErrorBody(raw); nestedMessage != "" {
+			if code == "" {
+				code = nestedCode
+			}
+			return code, nestedMessage
+		}
+	}
+	return code, ""
+}
+
+// jsonScalar returns a JSON string or number as a string, or "" for anything else
+func jsonScalar(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// parseRateLimit reads the x-ratelimit-* headers, or returns nil if there are none
+func parseRateLimit(header http.Header) *RateLimit {
+	limit, limitErr := strconv.Atoi(header.Get("x-ratelimit-limit"))
+	remaining, remainingErr := strconv.Atoi(header.Get("x-ratelimit-remaining"))
+	reset, resetErr := parseResetTime(header.Get("x-ratelimit-reset"))
+	if limitErr != nil && remainingErr != nil && resetErr != nil {
+		return nil
+	}
+	return &RateLimit{Limit: limit, Remaining: remaining, Reset: reset}
+}
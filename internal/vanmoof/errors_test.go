@@ -0,0 +1,107 @@
+package vanmoof
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	const bikeURL = "https://bikeapi.example.com/bikes/1001/create_certificate"
+	const authURL = "https://api.example.com/v8/authenticate"
+	sentinels := []error{ErrUnauthorized, ErrRateLimited, ErrBikeNotFound, ErrNotSupported}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		url    string
+		status int
+		body   string
+		want   error // nil: none of the sentinels
+	}{
+		{"unauthorized", "POST", authURL, http.StatusUnauthorized, `{"message": "Invalid credentials"}`, ErrUnauthorized},
+		{"rate limited", "POST", authURL, http.StatusTooManyRequests, `Too Many Requests`, ErrRateLimited},
+		{"bike 404", "GET", bikeURL, http.StatusNotFound, ``, ErrBikeNotFound},
+		{"bike not found body", "POST", bikeURL, http.StatusOK, `{"err": "Bike not found"}`, ErrBikeNotFound},
+		{"bike not supported body", "POST", bikeURL, http.StatusOK, `{"err": {"code": "E42", "message": "Bike is not supported"}}`, ErrNotSupported},
+		{"not implemented", "POST", authURL, http.StatusNotImplemented, ``, ErrNotSupported},
+		{"404 outside the bike API", "GET", authURL, http.StatusNotFound, `{"message": "not found"}`, nil},
+		{"server error", "POST", bikeURL, http.StatusInternalServerError, `{"error": "internal"}`, nil},
+		{"malformed body", "POST", bikeURL, http.StatusBadRequest, `{"err": "unterminated`, nil},
+	} {
+		err := error(newAPIError(tc.method, tc.url, tc.status, nil, []byte(tc.body)))
+		for _, sentinel := range sentinels {
+			if got := errors.Is(err, sentinel); got != (sentinel == tc.want) {
+				t.Errorf("%s: errors.Is(%v, %v) = %v", tc.name, err, sentinel, got)
+			}
+		}
+	}
+}
+
+func TestParseErrorBody(t *testing.T) {
+	for _, tc := range []struct {
+		body          string
+		code, message string
+	}{
+		{`{"err": "Bike not found"}`, "", "Bike not found"},
+		{`{"error": "invalid_grant", "error_description": "expired"}`, "", "invalid_grant"},
+		{`{"message": "Invalid credentials", "code": 1001}`, "1001", "Invalid credentials"},
+		{`{"errorCode": "E1", "err": {"code": "E2", "message": "nested"}}`, "E1", "nested"},
+		{`{"err": {"code": "E2", "message": "nested"}}`, "E2", "nested"},
+		{`{"error": null, "message": "fallback"}`, "", "fallback"},
+		{`{"err": "unterminated`, "", ""},
+		{`<html>Bad Gateway</html>`, "", ""},
+		{`["not", "an", "object"]`, "", ""},
+	} {
+		code, message := parseErrorBody([]byte(tc.body))
+		if code != tc.code || message != tc.message {
+			t.Errorf("parseErrorBody(%s) = %q, %q; want %q, %q", tc.body, code, message, tc.code, tc.message)
+		}
+	}
+
+	// Bodies that are not recognised become the message, truncated
+	long := []byte(strings.Repeat("x", 600))
+	e := newAPIError("GET", "https://api.example.com/v8/bikes", http.StatusBadGateway, nil, long)
+	if len(e.Message) != 500+len("... (truncated)") || e.Code != "" {
+		t.Errorf("message of %d bytes, code %q; want the body truncated to 500 bytes", len(e.Message), e.Code)
+	}
+	if e.Endpoint != "GET /v8/bikes" {
+		t.Errorf("Endpoint = %q", e.Endpoint)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	reset := time.Unix(1767668550, 0)
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		want   *RateLimit
+	}{
+		{"none", http.Header{}, nil},
+		{"all", http.Header{
+			"X-Ratelimit-Limit":     {"100"},
+			"X-Ratelimit-Remaining": {"0"},
+			"X-Ratelimit-Reset":     {"1767668550"},
+		}, &RateLimit{Limit: 100, Remaining: 0, Reset: reset}},
+		{"only reset", http.Header{"X-Ratelimit-Reset": {"1767668550"}}, &RateLimit{Reset: reset}},
+		{"malformed", http.Header{"X-Ratelimit-Limit": {"lots"}, "X-Ratelimit-Reset": {"soon"}}, nil},
+	} {
+		got := parseRateLimit(tc.header)
+		if (got == nil) != (tc.want == nil) || got != nil && (got.Limit != tc.want.Limit || got.Remaining != tc.want.Remaining || !got.Reset.Equal(tc.want.Reset)) {
+			t.Errorf("%s: parseRateLimit = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	// A 429 carries its rate limit and matches ErrRateLimited when wrapped
+	header := http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1767668550"}}
+	err := error(newAPIError("POST", "https://api.example.com/v8/authenticate", http.StatusTooManyRequests, header, nil))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RateLimit == nil || !apiErr.RateLimit.Reset.Equal(reset) {
+		t.Errorf("rate limit of %v = %+v", err, apiErr)
+	}
+	if !errors.Is(errors.Join(errors.New("authentication failed"), err), ErrRateLimited) {
+		t.Error("wrapped 429 does not match ErrRateLimited")
+	}
+}
@@ -2,13 +2,82 @@ package vanmoof
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 )
 
+// Client talks to the VanMoof APIs. The zero value is not usable; use NewClient.
+type Client struct {
+	APIBaseURL             string // VanMoof API (authentication, customer data)
+	BikeAPIBaseURL         string // Bike API (certificate creation)
+	VehicleRegistryBaseURL string // Vehicle Registry API (shared bikes)
+	APIKey                 string
+
+	// Password used when no cached token is usable; empty falls back to
+	// VANMOOF_PASSWORD and then prompts
+	Password string
+
+	// CredentialHelper is asked for the password before prompting, and stores
+	// prompted passwords the API accepts; nil disables it
+	CredentialHelper *CredentialHelper
+	// NetrcPath is a netrc file consulted for the password before prompting,
+	// see DefaultNetrcPath; empty disables it
+	NetrcPath string
+
+	// BikeCachePath is where the bikes of each account are remembered for
+	// shell completion, see LoadBikeCache; empty disables it
+	BikeCachePath string
+
+	// CertificateDir receives a JSON file per issued certificate, including
+	// the generated private key, see Paths.Certificates; empty disables it
+	CertificateDir string
+
+	// TokenStore persists tokens between runs; nil uses a FileTokenStore at
+	// TokenCachePath(), encrypted with VANMOOF_CACHE_KEY if set
+	TokenStore TokenStore
+
+	HTTPClient *http.Client
+	Retry      RetryPolicy
+
+	// Logger receives log records; nil disables logging. Secrets are
+	// redacted before they reach its handler unless DebugUnsafe is set.
+	Logger *slog.Logger
+	// DebugUnsafe disables the redaction of tokens, credentials, emails and
+	// private keys in log records
+	DebugUnsafe bool
+
+	rateLimit *rateLimiter // Shared by copies made with with()
+}
+
+// NewClient returns a client for the production VanMoof APIs
+func NewClient() *Client {
+	return &Client{
+		APIBaseURL:             apiBaseURL,
+		BikeAPIBaseURL:         bikeApiBaseURL,
+		VehicleRegistryBaseURL: vehicleRegistryBaseURL,
+		APIKey:                 apiKey,
+		HTTPClient:             NewHTTPClient(),
+		Retry:                  DefaultRetryPolicy(),
+		rateLimit:              &rateLimiter{},
+	}
+}
+
+// NewHTTPClient returns the http.Client used by NewClient
+func NewHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		// Do not follow redirects to prevent leaking auth headers to redirect targets
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
 // parseResetTime parses the x-ratelimit-reset header value (Unix timestamp) into a time.Time
 func parseResetTime(reset string) (time.Time, error) {
 	timestamp, err := strconv.ParseInt(reset, 10, 64)
@@ -18,26 +87,78 @@ func parseResetTime(reset string) (time.Time, error) {
 	return time.Unix(timestamp, 0), nil
 }
 
-func doHTTPRequest(method, url string, body io.Reader, headers map[string]string, debug bool) ([]byte, error) {
-	if debug {
-		fmt.Printf("[DEBUG] %s %s\n", method, url)
-		if body != nil {
-			if buf, ok := body.(*bytes.Buffer); ok {
-				fmt.Printf("[DEBUG] Request body: %s\n", buf.String())
-			}
+// doHTTPRequest sends a request and returns the response body, retrying
+// according to c.Retry. Non-idempotent requests (POST) are only retried when
+// the server did not process them: after a 429 or a failed connection attempt,
+// as a repeated POST could e.g. issue a second certificate. Responses with
+// status >= 400 are returned as *APIError. Cancelling ctx aborts the request
+// and any wait before a retry.
+func (c *Client) doHTTPRequest(ctx context.Context, method, url string, body io.Reader, headers map[string]string) ([]byte, error) {
+	log := c.log().With("request_id", newRequestID())
+
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(body); err != nil {
+			return nil, err
 		}
 	}
+	log.Debug("HTTP request", "method", method, "url", url, "body", string(reqBody))
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		// Do not follow redirects to prevent leaking auth headers to redirect targets
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	idempotent := isIdempotent(method)
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		if err := c.waitForRateLimit(ctx, log, start); err != nil {
+			return nil, err
+		}
+
+		status, header, respBody, err := c.send(ctx, log, method, url, reqBody, headers)
+
+		var delay time.Duration
+		retry := false
+		if err != nil {
+			if ctx.Err() == nil && isTransientError(err) {
+				delay, retry = c.Retry.backoff(attempt), true
+			}
+		} else {
+			delay, retry = c.retryDelay(attempt, status, header)
+		}
+		if retry && !idempotent && status != http.StatusTooManyRequests && !isUnsentError(err) {
+			log.Debug("Not retrying non-idempotent request that may have been processed", "method", method)
+			retry = false
+		}
+		if retry && (attempt >= c.Retry.MaxAttempts || time.Since(start)+delay > c.Retry.MaxElapsed) {
+			log.Debug("Giving up retrying", "attempts", attempt, "elapsed", time.Since(start).Round(time.Millisecond).String())
+			retry = false
+		}
+
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			// Check for HTTP errors
+			if status >= 400 {
+				return nil, newAPIError(method, url, status, header, respBody)
+			}
+			return respBody, nil
+		}
+
+		reason := fmt.Sprintf("HTTP %d", status)
+		if err != nil {
+			reason = err.Error()
+		}
+		log.Info("Retrying HTTP request", "attempt", attempt+1, "delay", delay.Round(time.Millisecond).String(), "reason", reason)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
 	}
-	req, err := http.NewRequest(method, url, body)
+}
+
+// send performs a single HTTP request attempt and reads the response
+func (c *Client) send(ctx context.Context, log *slog.Logger, method, url string, reqBody []byte, headers map[string]string) (int, http.Header, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(reqBody))
 	if err != nil {
-		return nil, err
+		return 0, nil, nil, err
 	}
 
 	// Set headers
@@ -45,57 +166,46 @@ func doHTTPRequest(method, url string, body io.Reader, headers map[string]string
 		req.Header.Set(key, value)
 	}
 
-	resp, err := client.Do(req)
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, err
+		log.Debug("HTTP request failed", "error", err)
+		return 0, nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	if debug {
-		fmt.Printf("[DEBUG] Response status: %d\n", resp.StatusCode)
+	c.rateLimit.update(resp.Header)
 
-		// Display rate limit headers in human-readable format
-		if limit := resp.Header.Get("x-ratelimit-limit"); limit != "" {
-			fmt.Printf("[DEBUG] Rate Limit: %s requests\n", limit)
-		}
-		if remaining := resp.Header.Get("x-ratelimit-remaining"); remaining != "" {
-			fmt.Printf("[DEBUG] Rate Limit Remaining: %s requests\n", remaining)
-		}
-		if reset := resp.Header.Get("x-ratelimit-reset"); reset != "" {
-			if resetTime, err := parseResetTime(reset); err == nil {
-				fmt.Printf("[DEBUG] Rate Limit Reset: %s (in %s)\n",
-					resetTime.Format("2006-01-02 15:04:05 MST"),
-					time.Until(resetTime).Round(time.Second))
-			} else {
-				fmt.Printf("[DEBUG] Rate Limit Reset: %s\n", reset)
-			}
+	// Rate limit headers in human-readable form
+	var rateLimit []any
+	if limit := resp.Header.Get("x-ratelimit-limit"); limit != "" {
+		rateLimit = append(rateLimit, "limit", limit)
+	}
+	if remaining := resp.Header.Get("x-ratelimit-remaining"); remaining != "" {
+		rateLimit = append(rateLimit, "remaining", remaining)
+	}
+	if reset := resp.Header.Get("x-ratelimit-reset"); reset != "" {
+		if resetTime, err := parseResetTime(reset); err == nil {
+			rateLimit = append(rateLimit, "reset", resetTime.Format("2006-01-02 15:04:05 MST"), "reset_in", time.Until(resetTime).Round(time.Second).String())
+		} else {
+			rateLimit = append(rateLimit, "reset", reset)
 		}
 	}
+	if len(rateLimit) > 0 {
+		log = log.With(slog.Group("rate_limit", rateLimit...))
+	}
 
 	// Limit response body to 10 MB to prevent OOM from malicious/broken servers
 	const maxResponseSize = 10 * 1024 * 1024
 	limitedReader := io.LimitReader(resp.Body, maxResponseSize+1)
 	respBody, err := io.ReadAll(limitedReader)
 	if err != nil {
-		return nil, err
+		return 0, nil, nil, err
 	}
 	if len(respBody) > maxResponseSize {
-		return nil, fmt.Errorf("response body too large (>%d bytes)", maxResponseSize)
-	}
-
-	if debug {
-		fmt.Printf("[DEBUG] Response body length: %d bytes\n", len(respBody))
-		fmt.Printf("[DEBUG] Response body: %s\n", string(respBody))
-	}
-
-	// Check for HTTP errors
-	if resp.StatusCode >= 400 {
-		body := string(respBody)
-		if len(body) > 500 {
-			body = body[:500] + "... (truncated)"
-		}
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, body)
+		return 0, nil, nil, fmt.Errorf("response body too large (>%d bytes)", maxResponseSize)
 	}
 
-	return respBody, nil
+	log.Debug("HTTP response", "status", resp.StatusCode, "duration", time.Since(start).Round(time.Millisecond).String(), "bytes", len(respBody), "body", string(respBody))
+	return resp.StatusCode, resp.Header, respBody, nil
 }
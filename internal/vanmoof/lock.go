@@ -0,0 +1,39 @@
+package vanmoof
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// tokenCacheLockTimeout bounds how long a run waits for another run to
+// release the token cache
+const tokenCacheLockTimeout = 10 * time.Second
+
+// lockTokenCache takes the advisory lock serializing read-modify-write cycles
+// of the token cache at path between goroutines and processes, and returns
+// the function releasing it. Reads do not need it because writes are atomic.
+func lockTokenCache(path string, log *slog.Logger) (func(), error) {
+	if err := ensureTokenCacheDir(path); err != nil {
+		return nil, err
+	}
+
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(tokenCacheLockTimeout)
+	for waiting := false; ; waiting = true {
+		unlock, locked, err := tryLockFile(lockPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock token cache: %w", err)
+		}
+		if locked {
+			return unlock, nil
+		}
+		if !waiting {
+			log.Debug("Waiting for token cache lock", "path", lockPath)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %s waiting for token cache lock %s", tokenCacheLockTimeout, lockPath)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package vanmoof
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// staleLockAge is the age after which a lock file left behind by a crashed
+// process is removed. Holders keep the lock for milliseconds.
+const staleLockAge = time.Minute
+
+// tryLockFile takes the lock by creating path exclusively, on platforms
+// without flock or LockFileEx
+func tryLockFile(path string) (unlock func(), locked bool, err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+		}
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	f.Close()
+	return func() { os.Remove(path) }, true, nil
+}
@@ -0,0 +1,109 @@
+package vanmoof
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// log returns the logger to write to: Logger, wrapped in a RedactingHandler
+// unless DebugUnsafe is set, or a logger discarding everything if Logger is nil.
+// Loggers already wrapped by with are returned as they are.
+func (c *Client) log() *slog.Logger {
+	if c.Logger == nil {
+		return discardLogger
+	}
+	if c.DebugUnsafe {
+		return c.Logger
+	}
+	if _, ok := c.Logger.Handler().(*RedactingHandler); ok {
+		return c.Logger
+	}
+	return slog.New(NewRedactingHandler(c.Logger.Handler()))
+}
+
+// debug reports whether debug logging is enabled
+func (c *Client) debug() bool {
+	return c.Logger != nil && c.Logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// with returns a copy of the client whose log records carry the given
+// attributes. Its Logger is wrapped for redaction once, so the exported
+// methods call it up front instead of wrapping on every log call.
+func (c *Client) with(args ...any) *Client {
+	clone := *c
+	if c.Logger != nil {
+		clone.Logger = c.log().With(args...)
+	}
+	return &clone
+}
+
+// newRequestID returns a random ID correlating the log records of one HTTP request
+func newRequestID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RedactingHandler masks secrets (see RedactSecrets) in the message and
+// string, error and group attributes of log records before passing them on
+type RedactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler wraps next; a handler that is already redacting is returned as-is
+func NewRedactingHandler(next slog.Handler) slog.Handler {
+	if _, ok := next.(*RedactingHandler); ok {
+		return next
+	}
+	return &RedactingHandler{next: next}
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redactedRecord := slog.NewRecord(r.Time, r.Level, RedactSecrets(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redactedRecord.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redactedRecord)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redactedAttrs[i] = redactAttr(a)
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redactedAttrs)}
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr masks secrets in string and error values, recursing into groups
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(RedactSecrets(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redactedGroup := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redactedGroup[i] = redactAttr(ga)
+		}
+		a.Value = slog.GroupValue(redactedGroup...)
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(RedactSecrets(err.Error()))
+		}
+	}
+	return a
+}
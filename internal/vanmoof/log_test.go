@@ -0,0 +1,45 @@
+package vanmoof
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestClientLogRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	c := &Client{Logger: slog.New(slog.NewTextHandler(&buf, nil))}
+
+	// The redacting handler is added once by with, not on every call
+	c = c.with("op", "test")
+	if _, ok := c.Logger.Handler().(*RedactingHandler); !ok {
+		t.Fatalf("with left handler %T unwrapped", c.Logger.Handler())
+	}
+	if c.log() != c.Logger || c.with().log() != c.Logger {
+		t.Error("log wrapped an already redacting logger again")
+	}
+	if _, ok := c.with("bike", "x").Logger.Handler().(*RedactingHandler); !ok {
+		t.Error("nested with lost the redacting handler")
+	}
+
+	c.log().Info("Auth token received", "email", "user@example.com")
+	if out := buf.String(); strings.Contains(out, "user@example.com") || !strings.Contains(out, "op=test") {
+		t.Errorf("log output %q, want the email redacted and op kept", out)
+	}
+
+	// Loggers that did not pass through with are still redacted
+	buf.Reset()
+	(&Client{Logger: slog.New(slog.NewTextHandler(&buf, nil))}).log().Info("login", "email", "user@example.com")
+	if strings.Contains(buf.String(), "user@example.com") {
+		t.Errorf("log output %q, want the email redacted", buf.String())
+	}
+
+	// DebugUnsafe logs as is
+	buf.Reset()
+	raw := (&Client{Logger: slog.New(slog.NewTextHandler(&buf, nil)), DebugUnsafe: true}).with()
+	raw.log().Info("login", "email", "user@example.com")
+	if !strings.Contains(buf.String(), "user@example.com") {
+		t.Errorf("log output %q, want the email with DebugUnsafe", buf.String())
+	}
+}
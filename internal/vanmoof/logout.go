@@ -0,0 +1,51 @@
+package vanmoof
+
+import (
+	"context"
+	"errors"
+)
+
+// RemoveCachedAccount removes the stored tokens of email, keeping the other
+// accounts, and returns them, or nil if email was not stored
+func RemoveCachedAccount(ctx context.Context, store TokenStore, email string) (*CachedTokens, error) {
+	tokens, err := store.Load(ctx, email)
+	if err != nil || tokens == nil {
+		return nil, err
+	}
+	if err := store.Erase(ctx, email); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// PurgeTokenCache removes the tokens of all accounts from the store and
+// returns them. Stores implementing TokenPurger remove them at once; the file
+// store deletes its file even if it cannot be read, for example because the
+// cache key was lost, and no tokens are returned then. Other stores need to
+// implement TokenLister and have their accounts erased one by one.
+func PurgeTokenCache(ctx context.Context, store TokenStore) (map[string]CachedTokens, error) {
+	if p, ok := store.(TokenPurger); ok {
+		return p.Purge(ctx)
+	}
+	return purgeListed(ctx, store)
+}
+
+// RevokeTokens asks the API to invalidate the auth token, and with it the
+// tokens derived from it. An expired auth token is first renewed with the
+// refresh token. The API does not document this call, so revocation is best
+// effort: an error means the tokens may stay valid until they expire, and
+// removing them from the cache must not depend on it.
+func (c *Client) RevokeTokens(ctx context.Context, tokens CachedTokens) error {
+	c = c.with()
+	authToken := tokens.AuthToken
+	if isJWTExpired(authToken) {
+		if tokens.RefreshToken == "" {
+			return errors.New("no valid auth or refresh token to revoke")
+		}
+		var err error
+		if authToken, _, err = c.refreshAuthToken(ctx, tokens.RefreshToken); err != nil {
+			return err
+		}
+	}
+	return c.logout(ctx, authToken)
+}
@@ -0,0 +1,96 @@
+package vanmoof
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Output formats for ProcessCertificate and GetCert
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// IsValidOutputFormat reports whether format is a supported output format
+func IsValidOutputFormat(format string) bool {
+	return format == OutputText || format == OutputJSON
+}
+
+// printJSON writes v as a single line, so repeated calls produce JSON Lines
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+	}
+}
+
+// errorJSON is emitted in JSON mode when no other result can be produced
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// MarshalJSON renders all parsed fields, with binary values in base64
+func (c *Certificate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Certificate string `json:"certificate"`
+		Signature   string `json:"signature"`
+		ID          uint32 `json:"id"`
+		FrameID     string `json:"frame_id"`
+		BikeID      string `json:"bike_id"`
+		Expiry      uint32 `json:"expiry"`
+		ExpiresAt   string `json:"expires_at"`
+		Role        uint8  `json:"role"`
+		RoleName    string `json:"role_name"`
+		UserID      string `json:"user_id"`
+		PublicKey   string `json:"public_key"`
+	}{
+		Certificate: base64.StdEncoding.EncodeToString(c.Raw),
+		Signature:   base64.StdEncoding.EncodeToString(c.Signature),
+		ID:          c.ID,
+		FrameID:     c.FrameID,
+		BikeID:      c.BikeID,
+		Expiry:      c.Expiry,
+		ExpiresAt:   c.ExpiryTime().UTC().Format(time.RFC3339),
+		Role:        c.Role,
+		RoleName:    c.RoleDescription(),
+		UserID:      c.UserUUID(),
+		PublicKey:   base64.StdEncoding.EncodeToString(c.PublicKey),
+	})
+}
+
+// MarshalJSON adds the overall verdict and renders empty lists as []
+func (r *VerifyReport) MarshalJSON() ([]byte, error) {
+	type report VerifyReport // drops the method set to avoid recursion
+	out := (*report)(r)
+	if out.Errors == nil || out.Warnings == nil {
+		cp := *out
+		if cp.Errors == nil {
+			cp.Errors = []string{}
+		}
+		if cp.Warnings == nil {
+			cp.Warnings = []string{}
+		}
+		out = &cp
+	}
+	return json.Marshal(struct {
+		Valid bool `json:"valid"`
+		*report
+	}{r.Valid(), out})
+}
+
+// MarshalJSON renders the CA in the trust store file format plus its key ID
+func (ca *TrustedCA) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Label     string    `json:"label"`
+		KeyID     string    `json:"key_id"`
+		PublicKey string    `json:"public_key"`
+		NotBefore time.Time `json:"not_before,omitzero"`
+		NotAfter  time.Time `json:"not_after,omitzero"`
+		Revoked   bool      `json:"revoked,omitempty"`
+	}{ca.Label, ca.KeyID(), hex.EncodeToString(ca.PublicKey), ca.NotBefore, ca.NotAfter, ca.Revoked})
+}
@@ -0,0 +1,73 @@
+package vanmoof
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestJSONSchema pins the JSON output of 'issue' and 'parse', which scripts
+// depend on. The fixture key signs deterministically, so the whole document
+// is fixed; run 'go test -update' after an intended schema change.
+func TestJSONSchema(t *testing.T) {
+	ca := &TestCA{PrivateKey: fixtureKey()}
+	bike := BikeData{Name: "Demo", BikeID: 1001, FrameNumber: "SVTBKL00063OA", FrameSerial: "FS1", BleProfile: "ELECTRIFIED_2022", MainEcuSerial: "ECU1"}
+	raw, err := ca.Issue(testPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := ca.TrustStore()
+	store.CAs[0].NotAfter = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	report, err := CheckCertificate(base64.StdEncoding.EncodeToString(raw), VerifyOptions{
+		PublicKey:  base64.StdEncoding.EncodeToString(testPayload().PublicKey),
+		BikeID:     "1001",
+		UserID:     "11111111-1111-4111-9111-111111111111",
+		Bikes:      []BikeData{bike},
+		TrustStore: store,
+		Now:        testNow,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []any{
+		&IssuedCertificate{
+			Bike:        bike,
+			Model:       "S5",
+			Certificate: base64.StdEncoding.EncodeToString(raw),
+			PublicKey:   base64.StdEncoding.EncodeToString(testPayload().PublicKey),
+			Report:      report,
+		},
+		&IssuedCertificate{Bike: BikeData{BikeID: 1003, FrameNumber: "ASY1234567"}, Model: "S3", Error: "bike not supported"},
+		&VerifyReport{Certificate: report.Certificate}, // Empty lists and no signer
+	}
+
+	var got bytes.Buffer
+	enc := json.NewEncoder(&got)
+	enc.SetEscapeHTML(false) // As printJSON
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const golden = "testdata/output.jsonl"
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("JSON output differs from %s\n got:\n%s\nwant:\n%s", golden, got.Bytes(), want)
+	}
+}
@@ -0,0 +1,183 @@
+package vanmoof
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const (
+	appDirName    = "vanmoof-certificates"
+	legacyDirName = ".vanmoof-certificates"
+	configFile    = "config.json"
+	keysDir       = "keys"
+	certsDir      = "certificates"
+)
+
+// Paths locates everything the tool persists. DefaultPaths follows the XDG
+// base directories; HomePaths keeps everything in one directory.
+type Paths struct {
+	ConfigDir string // Configuration file and trust store
+	StateDir  string // Token cache, saved keys and issued certificates
+	CacheDir  string // Data that can be fetched again, e.g. the bike list
+}
+
+// Config returns the path of the configuration file
+func (p Paths) Config() string {
+	return filepath.Join(p.ConfigDir, configFile)
+}
+
+// TokenCache returns the path of the token cache file
+func (p Paths) TokenCache() string {
+	return filepath.Join(p.StateDir, tokenCacheFile)
+}
+
+// BikeCache returns the path of the bike list cache used for shell completion
+func (p Paths) BikeCache() string {
+	return filepath.Join(p.CacheDir, bikeCacheFile)
+}
+
+// TrustStore returns the path of the CA trust store file
+func (p Paths) TrustStore() string {
+	return filepath.Join(p.ConfigDir, trustStoreFile)
+}
+
+// Keys returns the directory of key pairs saved by 'keys generate'
+func (p Paths) Keys() string {
+	return filepath.Join(p.StateDir, keysDir)
+}
+
+// Certificates returns the directory of issued certificates, see Client.CertificateDir
+func (p Paths) Certificates() string {
+	return filepath.Join(p.StateDir, certsDir)
+}
+
+// HomePaths returns paths that keep everything in dir
+func HomePaths(dir string) Paths {
+	return Paths{ConfigDir: dir, StateDir: dir, CacheDir: dir}
+}
+
+// DefaultPaths returns HomePaths($VANMOOF_HOME) if set, and otherwise the
+// vanmoof-certificates directories in $XDG_CONFIG_HOME (~/.config),
+// $XDG_STATE_HOME (~/.local/state) and $XDG_CACHE_HOME (~/.cache). Without
+// the XDG variables, macOS and Windows use their own config and cache
+// directories, and keep state with the configuration.
+func DefaultPaths() (Paths, error) {
+	if home := os.Getenv("VANMOOF_HOME"); home != "" {
+		return HomePaths(home), nil
+	}
+
+	config, err := baseDir("XDG_CONFIG_HOME", ".config", os.UserConfigDir)
+	if err != nil {
+		return Paths{}, err
+	}
+	state, err := baseDir("XDG_STATE_HOME", filepath.Join(".local", "state"), os.UserConfigDir)
+	if err != nil {
+		return Paths{}, err
+	}
+	cache, err := baseDir("XDG_CACHE_HOME", ".cache", os.UserCacheDir)
+	if err != nil {
+		return Paths{}, err
+	}
+	return Paths{
+		ConfigDir: filepath.Join(config, appDirName),
+		StateDir:  filepath.Join(state, appDirName),
+		CacheDir:  filepath.Join(cache, appDirName),
+	}, nil
+}
+
+// baseDir returns the XDG base directory named by env, ignoring relative
+// paths as the specification requires. It defaults to ~/<fallback>, or on
+// macOS and Windows to the platform directory returned by native.
+func baseDir(env, fallback string, native func() (string, error)) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return native()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, fallback), nil
+}
+
+// LegacyDir returns ~/.vanmoof-certificates, where earlier versions kept all files
+func LegacyDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, legacyDirName), nil
+}
+
+// MigrateLegacyFiles moves the files of earlier versions from LegacyDir to
+// their place in p, unless a file is already there, and removes the legacy
+// directory once it is empty. It returns a description of each move.
+func MigrateLegacyFiles(p Paths) ([]string, error) {
+	legacyDir, err := LegacyDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(legacyDir); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	legacyTokens := filepath.Join(legacyDir, tokenCacheFile)
+	moves := []struct{ from, to string }{
+		{legacyTokens, p.TokenCache()},
+		{legacyTokens + tokenCacheBackupSuffix, p.TokenCache() + tokenCacheBackupSuffix},
+		{filepath.Join(legacyDir, trustStoreFile), p.TrustStore()},
+	}
+
+	// Only excludes concurrent runs of this version, which lock the cache too;
+	// earlier versions never locked it
+	unlock, err := lockTokenCache(legacyTokens, discardLogger)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var moved []string
+	for _, m := range moves {
+		ok, err := moveFile(m.from, m.to)
+		if err != nil {
+			return moved, fmt.Errorf("failed to move %s to %s: %w", m.from, m.to, err)
+		}
+		if ok {
+			moved = append(moved, fmt.Sprintf("%s to %s", m.from, m.to))
+		}
+	}
+	os.Remove(legacyTokens + ".lock")
+	os.Remove(legacyDir) // Fails, as intended, if other files are left
+	return moved, nil
+}
+
+// moveFile moves from to to unless from does not exist or to does, and
+// reports whether it did. Files are copied across file systems.
+func moveFile(from, to string) (bool, error) {
+	if from == to {
+		return false, nil
+	}
+	if _, err := os.Stat(from); errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if _, err := os.Stat(to); err == nil {
+		return false, nil
+	}
+	if err := ensureTokenCacheDir(to); err != nil {
+		return false, err
+	}
+	if err := os.Rename(from, to); err == nil {
+		syncDir(filepath.Dir(to))
+		return true, nil
+	}
+	if err := copyFileAtomic(from, to); err != nil {
+		return false, err
+	}
+	return true, os.Remove(from)
+}
@@ -0,0 +1,79 @@
+package vanmoof
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDefaultPaths(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" || runtime.GOOS == "plan9" {
+		t.Skip("XDG defaults only apply on Unix")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("VANMOOF_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "relative") // ignored, must be absolute
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "xdg-cache"))
+
+	p, err := DefaultPaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ got, want string }{
+		{p.Config(), filepath.Join(home, ".config", appDirName, configFile)},
+		{p.TokenCache(), filepath.Join(home, ".local", "state", appDirName, tokenCacheFile)},
+		{p.Keys(), filepath.Join(home, ".local", "state", appDirName, keysDir)},
+		{p.Certificates(), filepath.Join(home, ".local", "state", appDirName, certsDir)},
+		{p.BikeCache(), filepath.Join(home, "xdg-cache", appDirName, bikeCacheFile)},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("got %s, want %s", tc.got, tc.want)
+		}
+	}
+
+	t.Setenv("VANMOOF_HOME", filepath.Join(home, "vanmoof"))
+	if p, err := DefaultPaths(); err != nil || p != HomePaths(filepath.Join(home, "vanmoof")) {
+		t.Errorf("with VANMOOF_HOME: %+v, %v", p, err)
+	}
+}
+
+func TestMigrateLegacyFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("home", home)
+	legacyDir := filepath.Join(home, legacyDirName)
+	if err := os.MkdirAll(legacyDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{tokenCacheFile, trustStoreFile} {
+		if err := os.WriteFile(filepath.Join(legacyDir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := HomePaths(filepath.Join(home, "new"))
+
+	moved, err := MigrateLegacyFiles(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 2 {
+		t.Errorf("moved %q, want the token cache and trust store", moved)
+	}
+	for path, want := range map[string]string{p.TokenCache(): tokenCacheFile, p.TrustStore(): trustStoreFile} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != want {
+			t.Errorf("%s: %q, %v", path, data, err)
+		}
+	}
+	if _, err := os.Stat(legacyDir); !os.IsNotExist(err) {
+		t.Errorf("legacy directory not removed: %v", err)
+	}
+
+	// Nothing is left to move the next time
+	if moved, err := MigrateLegacyFiles(p); err != nil || len(moved) != 0 {
+		t.Errorf("second migration: %q, %v", moved, err)
+	}
+}
@@ -0,0 +1,68 @@
+package vanmoof
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// readLine prompts on stderr and reads a line from stdin.
+// If ctx is cancelled the prompt is abandoned.
+func readLine(ctx context.Context, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	type result struct {
+		line string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		done <- result{strings.TrimSpace(line), err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.line, r.err
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stderr)
+		return "", ctx.Err()
+	}
+}
+
+// ReadPassword prompts for a password on the terminal without echoing it.
+// If ctx is cancelled the prompt is abandoned and the terminal state restored.
+func ReadPassword(ctx context.Context, prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", fmt.Errorf("error reading password: %w", err)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	type result struct {
+		password []byte
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		password, err := term.ReadPassword(fd)
+		done <- result{password, err}
+	}()
+
+	select {
+	case r := <-done:
+		fmt.Fprintln(os.Stderr)
+		if r.err != nil {
+			return "", fmt.Errorf("error reading password: %w", r.err)
+		}
+		return string(r.password), nil
+	case <-ctx.Done():
+		term.Restore(fd, state)
+		fmt.Fprintln(os.Stderr)
+		return "", ctx.Err()
+	}
+}
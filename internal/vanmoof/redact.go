@@ -0,0 +1,49 @@
+package vanmoof
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+var (
+	jwtPattern   = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// Credentials in Authorization header values
+	authSchemePattern = regexp.MustCompile(`\b(Basic|Bearer) [A-Za-z0-9+/=._-]+`)
+	// JSON fields holding secrets that are not recognisable by their value
+	secretFieldPattern = regexp.MustCompile(`"(token|refreshToken|refresh_token|auth_token|app_token|password|private_key)"(\s*:\s*)"[^"]*"`)
+	// Private keys printed as "Privkey = ..." or "private key: ..."
+	privateKeyPattern = regexp.MustCompile(`(?i)\b(priv(?:ate)?[ _-]?key\s*[:=]\s*)[A-Za-z0-9+/=]+`)
+	pemKeyPattern     = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+// RedactSecrets masks JWTs, refresh tokens, passwords, Basic and Bearer
+// credentials, email addresses and private keys in s
+func RedactSecrets(s string) string {
+	s = secretFieldPattern.ReplaceAllString(s, `"$1"$2"`+redacted+`"`)
+	s = authSchemePattern.ReplaceAllString(s, "$1 "+redacted)
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = pemKeyPattern.ReplaceAllString(s, redacted)
+	s = privateKeyPattern.ReplaceAllString(s, "${1}"+redacted)
+	s = emailPattern.ReplaceAllString(s, redacted)
+	return s
+}
+
+// redactHeader returns a copy of h with credentials masked, keeping the auth scheme
+func redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for key, values := range out {
+		for i, v := range values {
+			if strings.EqualFold(key, "Authorization") {
+				scheme, _, _ := strings.Cut(v, " ")
+				values[i] = scheme + " " + redacted
+			} else {
+				values[i] = RedactSecrets(v)
+			}
+		}
+	}
+	return out
+}
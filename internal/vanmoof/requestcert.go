@@ -1,207 +1,247 @@
 package vanmoof
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-
-	"golang.org/x/term"
+	"path/filepath"
+	"time"
 )
 
-// resolveTokens tries cached tokens first, then falls back to password auth.
-// Returns authToken, appToken, refreshToken.
-func resolveTokens(email, password string, debug, noCache bool) (string, string, string, error) {
-	var cached *CachedTokens
-	if !noCache {
-		cached = loadTokenCache(email, debug)
-	}
-
+// resolveTokens tries the cached tokens (nil if there are none) first, then
+// falls back to password auth. New auth and refresh tokens are cached even if
+// a later step fails, so an interrupted run does not lose them.
+func (c *Client) resolveTokens(ctx context.Context, email, password string, noCache bool, cached *CachedTokens) (CachedTokens, error) {
 	if cached != nil {
 		// Try app token first (valid ~2 hours)
 		if !isJWTExpired(cached.AppToken) {
-			if debug {
-				fmt.Println("[DEBUG] Using cached app token")
-			}
-			return cached.AuthToken, cached.AppToken, cached.RefreshToken, nil
+			c.log().Debug("Using cached app token")
+			return *cached, nil
 		}
 
 		// App token expired — try auth token (valid ~1 year)
 		if !isJWTExpired(cached.AuthToken) {
-			if debug {
-				fmt.Println("[DEBUG] App token expired, refreshing with cached auth token")
-			}
-			appToken, err := getApplicationToken(cached.AuthToken, debug)
+			c.log().Debug("App token expired, refreshing with cached auth token")
+			appToken, err := c.getApplicationToken(ctx, cached.AuthToken)
 			if err == nil {
+				tokens := CachedTokens{AuthToken: cached.AuthToken, AppToken: appToken, RefreshToken: cached.RefreshToken}
 				if !noCache {
-					saveTokenCache(email, cached.AuthToken, cached.RefreshToken, appToken, debug)
+					c.saveTokenCache(ctx, email, tokens)
 				}
-				return cached.AuthToken, appToken, cached.RefreshToken, nil
+				return tokens, nil
 			}
-			if debug {
-				fmt.Printf("[DEBUG] Failed to get app token with cached auth token: %v\n", err)
+			if ctx.Err() != nil {
+				return CachedTokens{}, ctx.Err()
 			}
+			c.log().Debug("Failed to get app token with cached auth token", "error", err)
 		}
 
 		// Auth token expired — try refresh token
 		if cached.RefreshToken != "" {
-			if debug {
-				fmt.Println("[DEBUG] Auth token expired, trying refresh token")
-			}
-			authToken, err := refreshAuthToken(cached.RefreshToken, debug)
+			c.log().Debug("Auth token expired, trying refresh token")
+			authToken, refreshToken, err := c.refreshAuthToken(ctx, cached.RefreshToken)
 			if err == nil {
-				appToken, err := getApplicationToken(authToken, debug)
-				if err == nil {
-					if !noCache {
-						saveTokenCache(email, authToken, cached.RefreshToken, appToken, debug)
-					}
-					return authToken, appToken, cached.RefreshToken, nil
+				// A rotated refresh token replaces the old one, which may no longer be valid
+				if refreshToken != "" && refreshToken != cached.RefreshToken {
+					c.log().Debug("Refresh token rotated")
+				} else {
+					refreshToken = cached.RefreshToken
 				}
-				if debug {
-					fmt.Printf("[DEBUG] Failed to get app token after refresh: %v\n", err)
+				appToken, err := c.getApplicationToken(ctx, authToken)
+				tokens := CachedTokens{AuthToken: authToken, AppToken: appToken, RefreshToken: refreshToken}
+				if !noCache {
+					c.saveTokenCache(ctx, email, tokens)
 				}
-			} else if debug {
-				fmt.Printf("[DEBUG] Refresh token failed: %v\n", err)
+				if err == nil {
+					return tokens, nil
+				}
+				c.log().Debug("Failed to get app token after refresh", "error", err)
+			} else {
+				c.log().Debug("Refresh token failed", "error", err)
+			}
+			if ctx.Err() != nil {
+				return CachedTokens{}, ctx.Err()
 			}
 		}
 
-		if debug {
-			fmt.Println("[DEBUG] All cached tokens expired, need password")
-		}
+		c.log().Debug("All cached tokens expired, need password")
 	}
 
 	// No valid cached tokens — need password
-	if password == "" {
-		password = os.Getenv("VANMOOF_PASSWORD")
-	}
-	if password == "" {
-		fmt.Print("Enter VanMoof password: ")
-		passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-		if err != nil {
-			return "", "", "", fmt.Errorf("error reading password: %w", err)
-		}
-		fmt.Println()
-		password = string(passwordBytes)
-	}
-	if password == "" {
-		return "", "", "", fmt.Errorf("password required")
+	password, source, err := c.resolvePassword(ctx, email, password)
+	if err != nil {
+		return CachedTokens{}, err
 	}
 
-	authToken, refreshToken, err := authenticate(email, password, debug)
+	authToken, refreshToken, err := c.authenticate(ctx, email, password)
+	c.updateCredentialHelper(ctx, email, password, source, err)
 	if err != nil {
-		return "", "", "", err
+		return CachedTokens{}, err
 	}
 	if authToken == "" {
-		return "", "", "", fmt.Errorf("authentication returned empty token")
+		return CachedTokens{}, fmt.Errorf("authentication returned empty token")
 	}
 
-	if debug {
-		fmt.Printf("[DEBUG] Auth token received: %s...\n", authToken[:min(20, len(authToken))])
-	}
+	c.log().Debug("Auth token received", "token", authToken)
 
-	appToken, err := getApplicationToken(authToken, debug)
+	appToken, err := c.getApplicationToken(ctx, authToken)
+	tokens := CachedTokens{AuthToken: authToken, AppToken: appToken, RefreshToken: refreshToken}
+	if !noCache {
+		c.saveTokenCache(ctx, email, tokens)
+	}
 	if err != nil {
-		return "", "", "", err
+		return CachedTokens{}, err
 	}
 	if appToken == "" {
-		return "", "", "", fmt.Errorf("application token request returned empty token")
+		return CachedTokens{}, fmt.Errorf("application token request returned empty token")
 	}
-
-	if !noCache {
-		saveTokenCache(email, authToken, refreshToken, appToken, debug)
-	}
-	return authToken, appToken, refreshToken, nil
+	return tokens, nil
 }
 
-func GetCert(email, bikeFilter, pubkey string, debug, noCache bool) error {
-	if debug {
-		fmt.Println("[DEBUG] Starting authentication...")
+// passwordSource is where a password came from
+type passwordSource int
+
+const (
+	passwordGiven passwordSource = iota // Client.Password or VANMOOF_PASSWORD
+	passwordHelper
+	passwordNetrc
+	passwordPrompt
+)
+
+// resolvePassword returns password if set, or else the first password found
+// in VANMOOF_PASSWORD, the credential helper, the netrc file or the prompt.
+// Credential helper and netrc failures are logged and skipped.
+func (c *Client) resolvePassword(ctx context.Context, email, password string) (string, passwordSource, error) {
+	if password == "" {
+		password = os.Getenv("VANMOOF_PASSWORD")
+	}
+	if password != "" {
+		return password, passwordGiven, nil
 	}
 
-	authToken, appToken, _, err := resolveTokens(email, "", debug, noCache)
-	if err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
+	cred := c.apiCredential(email)
+	if c.CredentialHelper != nil {
+		password, err := c.CredentialHelper.get(ctx, cred)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", 0, ctx.Err()
+			}
+			c.log().Warn("Failed to get password from credential helper", "error", err)
+		} else if password != "" {
+			c.log().Debug("Using password from credential helper")
+			return password, passwordHelper, nil
+		}
 	}
 
-	if debug {
-		fmt.Printf("[DEBUG] App token received: %s...\n", appToken[:min(20, len(appToken))])
+	if c.NetrcPath != "" {
+		password, err := netrcPassword(c.NetrcPath, cred.hostname(), email)
+		if err != nil {
+			c.log().Warn("Failed to read netrc file", "path", c.NetrcPath, "error", err)
+		} else if password != "" {
+			c.log().Debug("Using password from netrc file", "path", c.NetrcPath)
+			return password, passwordNetrc, nil
+		}
 	}
 
-	// Check for pending bike sharing invitations
-	pendingInvitations, err := getBikeSharingInvitations(authToken, debug)
+	password, err := ReadPassword(ctx, "Enter VanMoof password: ")
 	if err != nil {
-		if debug {
-			fmt.Printf("[DEBUG] Failed to check sharing invitations: %v\n", err)
+		return "", 0, err
+	}
+	if password == "" {
+		return "", 0, fmt.Errorf("password required")
+	}
+	return password, passwordPrompt, nil
+}
+
+// updateCredentialHelper tells the credential helper how the API received a
+// password, like git does: a prompted password it accepted is stored and a
+// password from the helper it rejected is erased. Failures are logged.
+func (c *Client) updateCredentialHelper(ctx context.Context, email, password string, source passwordSource, authErr error) {
+	if c.CredentialHelper == nil {
+		return
+	}
+	cred := c.apiCredential(email)
+	switch {
+	case authErr == nil && source == passwordPrompt:
+		if err := c.CredentialHelper.store(ctx, cred, password); err != nil {
+			c.log().Warn("Failed to store password with credential helper", "error", err)
+		}
+	case errors.Is(authErr, ErrUnauthorized) && source == passwordHelper:
+		c.log().Info("Password from credential helper rejected, erasing it")
+		if err := c.CredentialHelper.erase(ctx, cred, password); err != nil {
+			c.log().Warn("Failed to erase password with credential helper", "error", err)
 		}
-	} else if pendingInvitations > 0 {
-		fmt.Printf("WARNING: You have %d pending bike sharing invitation(s)! Accept them in the VanMoof app first.\n", pendingInvitations)
 	}
+}
 
-	// Get customer data (bikes)
-	customerUUID, bikes, err := getCustomerData(authToken, debug)
-	if err != nil {
-		return fmt.Errorf("failed to get customer data: %w", err)
+// GetCert requests certificates for the selected bikes and verifies them against trustStore (nil for the built-in keys).
+// With OutputJSON one JSON object per bike is printed (JSON Lines) and other messages go to stderr.
+func (c *Client) GetCert(email, bikeFilter, pubkey string, trustStore *TrustStore, output string, noCache bool) error {
+	return c.GetCertContext(context.Background(), email, bikeFilter, pubkey, trustStore, output, noCache)
+}
+
+// GetCertContext is GetCert with a context. If ctx is cancelled, the remaining
+// bikes are skipped, a summary of which bikes got a certificate is printed
+// and an error wrapping ctx.Err() is returned.
+//
+// A bike fails if its certificate cannot be issued or does not verify. If
+// every selected bike fails, the error of the first one is returned wrapped;
+// if only some fail, an error wrapping ErrPartialFailure.
+func (c *Client) GetCertContext(ctx context.Context, email, bikeFilter, pubkey string, trustStore *TrustStore, output string, noCache bool) error {
+	c = c.with()
+	jsonMode := output == OutputJSON
+	// Informational messages must not mix with JSON results on stdout
+	msgOut := os.Stdout
+	if jsonMode {
+		msgOut = os.Stderr
 	}
 
-	if debug {
-		fmt.Printf("[DEBUG] Customer UUID: %s\n", customerUUID)
-		fmt.Printf("[DEBUG] Retrieved %d owned bikes\n", len(bikes))
+	c.log().Debug("Starting authentication")
+
+	tm, err := c.newTokenManager(ctx, email, noCache)
+	if err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
 	}
 
-	// Fetch shared bikes from vehicle registry
-	sharedVehicles, err := getSharedVehicles(customerUUID, appToken, debug)
+	c.log().Debug("App token received", "token", tm.tokens.AppToken)
+
+	// Check for pending bike sharing invitations
+	pendingInvitations, err := c.getBikeSharingInvitations(ctx, tm)
 	if err != nil {
-		if debug {
-			fmt.Printf("[DEBUG] Failed to fetch shared vehicles: %v\n", err)
-		}
-	} else if debug {
-		fmt.Printf("[DEBUG] Retrieved %d shared vehicles\n", len(sharedVehicles))
-	}
-
-	// Convert shared vehicles to BikeData and merge
-	for _, v := range sharedVehicles {
-		// Skip if we already have this bike as an owned bike
-		alreadyOwned := false
-		for _, b := range bikes {
-			if b.FrameNumber == v.VehicleID {
-				alreadyOwned = true
-				break
-			}
-		}
-		if alreadyOwned {
-			continue
-		}
+		c.log().Debug("Failed to check sharing invitations", "error", err)
+	} else if pendingInvitations > 0 {
+		fmt.Fprintf(msgOut, "WARNING: You have %d pending bike sharing invitation(s)! Accept them in the VanMoof app first.\n", pendingInvitations)
+	}
 
-		bikes = append(bikes, BikeData{
-			Name:        v.Name + " (shared by " + v.OwnerName + ")",
-			FrameNumber: v.VehicleID,
-			BleProfile:  v.BleProfile,
-		})
+	// Get owned and shared bikes
+	customerUUID, bikes, err := c.fetchBikes(ctx, tm)
+	if err != nil {
+		return err
 	}
 
 	// Filter for supported bikes only
 	var supported []BikeData
 	for _, bike := range bikes {
-		for _, profile := range supportedBleProfiles {
-			if bike.BleProfile == profile {
-				supported = append(supported, bike)
-				break
-			}
+		if IsSupportedBike(bike) {
+			supported = append(supported, bike)
 		}
 	}
 
 	if len(supported) == 0 {
-		fmt.Println("No supported bikes found (SA5/S6)")
+		fmt.Fprintln(msgOut, "No supported bikes found (SA5/S6)")
 		return nil
 	}
 
 	// Filter bikes based on user selection
-	selectedBikes, err := selectBikes(supported, bikeFilter)
+	selectedBikes, err := selectBikes(ctx, supported, bikes, bikeFilter)
 	if err != nil {
 		return err
 	}
 
 	if len(selectedBikes) == 0 {
-		fmt.Println("No bikes selected")
+		fmt.Fprintln(msgOut, "No bikes selected")
 		return nil
 	}
 
@@ -209,70 +249,194 @@ func GetCert(email, bikeFilter, pubkey string, debug, noCache bool) error {
 
 	if pubkey != "" {
 		pubKeyB64 = pubkey
-		if debug {
-			fmt.Printf("[DEBUG] Using supplied public key for certificate requests: %s\n", pubKeyB64)
-		}
+		c.log().Debug("Using supplied public key for certificate requests", "public_key", pubKeyB64)
 	} else {
 		var genErr error
 		privKeyB64, pubKeyB64, genErr = GenerateED25519()
 		if genErr != nil {
 			return genErr
 		}
-		fmt.Printf("Privkey = %s\n", privKeyB64)
-		fmt.Printf("Pubkey = %s\n", pubKeyB64)
-		fmt.Println()
+		if !jsonMode {
+			fmt.Printf("Privkey = %s\n", privKeyB64)
+			fmt.Printf("Pubkey = %s\n", pubKeyB64)
+			fmt.Println()
+		}
 	}
 
 	// Process each selected bike and create certificate
+	var issued, missing []BikeData
+	var failures []error
 	for _, bike := range selectedBikes {
+		if ctx.Err() != nil {
+			missing = append(missing, bike)
+			continue
+		}
+
+		bikeIDStr := bike.FrameNumber
 		if bike.BikeID != 0 {
-			fmt.Printf("Bike ID: %d\n", bike.BikeID)
+			bikeIDStr = fmt.Sprintf("%d", bike.BikeID)
 		}
-		fmt.Printf("Name: %s\n", bike.Name)
-		fmt.Printf("Frame number: %s\n", bike.FrameNumber)
-		model := bleProfileModel[bike.BleProfile]
-		if model == "" {
-			model = bike.BleProfile
+		opts := VerifyOptions{
+			PublicKey:  pubKeyB64,
+			BikeID:     bikeIDStr,
+			UserID:     customerUUID,
+			Bikes:      bikes,
+			TrustStore: trustStore,
 		}
-		fmt.Printf("Model: %s\n", model)
 
-		if debug {
-			fmt.Printf("[DEBUG] Creating certificate for %s\n", bike.FrameNumber)
+		result := c.issueCertificate(ctx, tm, bike, pubKeyB64, opts)
+		result.PrivateKey = privKeyB64
+		if result.Certificate != "" {
+			issued = append(issued, bike)
+		} else {
+			missing = append(missing, bike)
 		}
-
-		certResp, err := createCertificate(bike.FrameNumber, pubKeyB64, appToken, debug)
-		if err != nil {
-			fmt.Printf("Failed to create certificate: %v\n", err)
-			continue
+		if err := result.err(); err != nil {
+			failures = append(failures, err)
 		}
 
-		// Check if response contains an error
-		var respData map[string]interface{}
-		if err := json.Unmarshal([]byte(certResp), &respData); err != nil {
-			fmt.Printf("Failed to parse certificate response: %v\n", err)
-			continue
+		if jsonMode {
+			printJSON(result)
+		} else {
+			printIssuedCertificate(result, opts, c.debug())
 		}
 
-		if _, hasErr := respData["err"]; hasErr {
-			fmt.Printf("Certificate error: %v\n", certResp)
-			continue
+		if c.CertificateDir != "" && result.Certificate != "" {
+			path, err := saveIssuedCertificate(c.CertificateDir, result, time.Now())
+			if err != nil {
+				c.log().Error("Failed to save certificate", "bike", bikeLabel(bike), "error", err)
+				failures = append(failures, err)
+			} else {
+				fmt.Fprintf(msgOut, "Saved to %s\n", path)
+			}
 		}
+	}
 
-		fmt.Println("Certificate:")
-		fmt.Println(certResp)
+	if err := ctx.Err(); err != nil {
+		printInterruptedSummary(msgOut, issued, missing)
+		return fmt.Errorf("interrupted after issuing %d of %d certificates: %w", len(issued), len(selectedBikes), err)
+	}
+	switch {
+	case len(failures) == 0:
+		return nil
+	case len(failures) == len(selectedBikes):
+		return fmt.Errorf("%d of %d certificates failed: %w", len(failures), len(selectedBikes), failures[0])
+	default:
+		return fmt.Errorf("%w: %d of %d certificates failed", ErrPartialFailure, len(failures), len(selectedBikes))
+	}
+}
 
-		// Parse the certificate
-		cert, ok := respData["certificate"].(string)
-		if !ok {
-			fmt.Println("Certificate response missing 'certificate' field")
-			continue
+// err returns why the certificate could not be issued or does not verify
+func (r IssuedCertificate) err() error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if r.Report != nil {
+		return r.Report.Err()
+	}
+	return nil
+}
+
+// saveIssuedCertificate writes result as JSON to a new file in dir, named
+// after the bike's frame number and the time of issue, and returns its path
+func saveIssuedCertificate(dir string, result IssuedCertificate, now time.Time) (string, error) {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create certificate dir: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.json", result.Bike.FrameNumber, now.UTC().Format("20060102T150405Z"))
+	path := filepath.Join(dir, filepath.Base(name))
+	// The file holds the private key, and an existing one is never replaced
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// printInterruptedSummary lists the bikes that did and did not get a certificate before an interruption
+func printInterruptedSummary(out *os.File, issued, missing []BikeData) {
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Interrupted.")
+	if len(issued) > 0 {
+		fmt.Fprintln(out, "Certificates issued for:")
+		for _, bike := range issued {
+			fmt.Fprintf(out, "  %s\n", bikeLabel(bike))
 		}
-		fmt.Println("Parsing certificate...")
-		bikeIDStr := bike.FrameNumber
-		if bike.BikeID != 0 {
-			bikeIDStr = fmt.Sprintf("%d", bike.BikeID)
+	}
+	if len(missing) > 0 {
+		fmt.Fprintln(out, "No certificate for:")
+		for _, bike := range missing {
+			fmt.Fprintf(out, "  %s\n", bikeLabel(bike))
 		}
-		ProcessCertificate(cert, pubKeyB64, bikeIDStr, customerUUID, bikes, debug)
 	}
-	return nil
+}
+
+// BikeModel returns the human-readable model name for a bike's BLE profile
+func BikeModel(bike BikeData) string {
+	if model := bleProfileModel[bike.BleProfile]; model != "" {
+		return model
+	}
+	return bike.BleProfile
+}
+
+// issueCertificate requests a certificate for one bike and verifies it, without printing
+func (c *Client) issueCertificate(ctx context.Context, tm *tokenManager, bike BikeData, pubKeyB64 string, opts VerifyOptions) IssuedCertificate {
+	// Log records of this bike, including its HTTP requests, carry the frame number
+	c = c.with("bike", bike.FrameNumber)
+
+	result := IssuedCertificate{
+		Bike:      bike,
+		Model:     BikeModel(bike),
+		PublicKey: pubKeyB64,
+	}
+
+	c.log().Debug("Creating certificate")
+
+	cert, rawResponse, err := c.createCertificate(ctx, tm, bike.FrameNumber, pubKeyB64)
+	result.rawResponse = string(rawResponse)
+	if err != nil {
+		result.Err = err
+		result.Error = fmt.Sprintf("Failed to create certificate: %v", err)
+		return result
+	}
+	result.Certificate = cert
+
+	report, err := CheckCertificate(cert, opts)
+	if err != nil {
+		result.Err = err
+		result.Error = fmt.Sprintf("Failed to parse certificate: %v", err)
+		return result
+	}
+	result.Report = report
+	return result
+}
+
+// printIssuedCertificate prints the outcome for one bike in text form
+func printIssuedCertificate(result IssuedCertificate, opts VerifyOptions, debug bool) {
+	bike := result.Bike
+	if bike.BikeID != 0 {
+		fmt.Printf("Bike ID: %d\n", bike.BikeID)
+	}
+	fmt.Printf("Name: %s\n", bike.Name)
+	fmt.Printf("Frame number: %s\n", bike.FrameNumber)
+	fmt.Printf("Model: %s\n", result.Model)
+
+	if result.Certificate != "" {
+		fmt.Println("Certificate:")
+		fmt.Println(result.rawResponse)
+		fmt.Println("Parsing certificate...")
+	}
+	if result.Report != nil {
+		printReport(result.Report, opts, debug)
+	} else if result.Error != "" {
+		fmt.Println(result.Error)
+	}
 }
@@ -0,0 +1,176 @@
+package vanmoof
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how requests are retried after rate limiting (429),
+// server errors (5xx) and transient network errors
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts per request including the first; 1 disables retries
+	BaseDelay   time.Duration // Backoff before the first retry, doubled for every further retry
+	MaxDelay    time.Duration // Upper bound of a single backoff
+	MaxElapsed  time.Duration // Upper bound of the total time spent on one request, including waits
+}
+
+// DefaultRetryPolicy returns the retry policy used by NewClient
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		MaxElapsed:  2 * time.Minute,
+	}
+}
+
+// backoff returns the delay before retry number attempt (1-based), with up to 25% jitter
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if jitter := int64(delay / 4); jitter > 0 {
+		delay += time.Duration(rand.Int64N(jitter))
+	}
+	return delay
+}
+
+// rateLimiter remembers when an exhausted rate limit resets, shared by all
+// requests of a client
+type rateLimiter struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// update records the reset time when the response reports no remaining requests
+func (l *rateLimiter) update(header http.Header) {
+	if l == nil || header.Get("x-ratelimit-remaining") != "0" {
+		return
+	}
+	resetTime, err := parseResetTime(header.Get("x-ratelimit-reset"))
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if resetTime.After(l.until) {
+		l.until = resetTime
+	}
+}
+
+// wait returns how long to wait until the rate limit resets
+func (l *rateLimiter) wait() time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Until(l.until)
+}
+
+// waitForRateLimit sleeps until an exhausted rate limit resets, unless that
+// would exceed the retry time left for the request started at start.
+// It returns ctx.Err() if ctx is cancelled while waiting.
+func (c *Client) waitForRateLimit(ctx context.Context, log *slog.Logger, start time.Time) error {
+	wait := c.rateLimit.wait()
+	if wait <= 0 {
+		return nil
+	}
+	if time.Since(start)+wait > c.Retry.MaxElapsed {
+		log.Debug("Rate limit exhausted, reset too far away to wait for", "wait", wait.Round(time.Second).String())
+		return nil
+	}
+	log.Warn("Rate limit exhausted, waiting for reset", "wait", wait.Round(time.Second).String())
+	return sleep(ctx, wait)
+}
+
+// sleep pauses for d, or returns ctx.Err() as soon as ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryDelay returns the delay before retrying a response with the given
+// status, or false if it must not be retried
+func (c *Client) retryDelay(attempt, status int, header http.Header) (time.Duration, bool) {
+	switch {
+	case status == http.StatusTooManyRequests:
+		if delay, ok := rateLimitDelay(header); ok {
+			return delay, true
+		}
+		return c.Retry.backoff(attempt), true
+	case status == http.StatusInternalServerError, status == http.StatusBadGateway,
+		status == http.StatusServiceUnavailable, status == http.StatusGatewayTimeout:
+		if delay, ok := rateLimitDelay(header); ok && status == http.StatusServiceUnavailable {
+			return delay, true
+		}
+		return c.Retry.backoff(attempt), true
+	default:
+		return 0, false
+	}
+}
+
+// rateLimitDelay returns the wait requested by Retry-After (seconds) or x-ratelimit-reset
+func rateLimitDelay(header http.Header) (time.Duration, bool) {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if resetTime, err := parseResetTime(header.Get("x-ratelimit-reset")); err == nil {
+		return max(time.Until(resetTime), 0), true
+	}
+	return 0, false
+}
+
+// isTransientError reports whether a request failed in a way worth retrying:
+// timeouts, failed connection attempts (e.g. refused), connections reset or
+// closed mid-response. Hosts that do not exist are not retried. Only the
+// portable net and io errors are inspected, so this works on every GOOS.
+func isTransientError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "read" || opErr.Op == "write") {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isUnsentError reports whether a request failed before any of it reached the
+// server, because no connection could be made
+func isUnsentError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isIdempotent reports whether sending a request with method twice has the
+// same effect as sending it once (RFC 9110, section 9.2.2)
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package vanmoof
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsTransientError(t *testing.T) {
+	// A port nobody listens on refuses connections
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	_, refused := http.Get("http://" + addr)
+	if refused == nil {
+		t.Fatal("request to a closed port succeeded")
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"refused", refused, true},
+		{"timeout", &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, true},
+		{"reset", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, true},
+		{"closed mid-response", fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), true},
+		{"unknown host", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, false},
+		{"cancelled", context.Canceled, false},
+		{"other", errors.New("malformed response"), false},
+	} {
+		if got := isTransientError(tc.err); got != tc.want {
+			t.Errorf("isTransientError(%s: %v) = %v, want %v", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestDoHTTPRequestRetries(t *testing.T) {
+	for _, tc := range []struct {
+		method    string
+		status    int
+		wantCalls int32
+	}{
+		{http.MethodGet, http.StatusInternalServerError, 3},
+		{http.MethodGet, http.StatusTooManyRequests, 3},
+		{http.MethodPost, http.StatusTooManyRequests, 3},
+		// The server may have issued a certificate before failing
+		{http.MethodPost, http.StatusInternalServerError, 1},
+		{http.MethodPost, http.StatusServiceUnavailable, 1},
+		{http.MethodGet, http.StatusNotFound, 1},
+	} {
+		t.Run(fmt.Sprintf("%s %d", tc.method, tc.status), func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			c := NewClient()
+			c.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxElapsed: 10 * time.Second}
+			if _, err := c.doHTTPRequest(context.Background(), tc.method, server.URL, nil, nil); err == nil {
+				t.Fatal("request succeeded")
+			}
+			if got := calls.Load(); got != tc.wantCalls {
+				t.Errorf("server saw %d requests, want %d", got, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoHTTPRequestRetriesUnsentPost(t *testing.T) {
+	// Connections are refused until the server starts, so the POST never reached it
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var calls atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	c := NewClient()
+	c.Retry = RetryPolicy{MaxAttempts: 10, BaseDelay: 50 * time.Millisecond, MaxDelay: 50 * time.Millisecond, MaxElapsed: 10 * time.Second}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if ln, err := net.Listen("tcp", addr); err == nil {
+			server.Listener = ln
+			server.Start()
+		}
+	}()
+
+	if _, err := c.doHTTPRequest(context.Background(), http.MethodPost, "http://"+addr, nil, nil); err != nil {
+		t.Skipf("could not listen on %s again: %v", addr, err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server saw %d requests, want 1", got)
+	}
+}
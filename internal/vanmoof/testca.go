@@ -0,0 +1,58 @@
+package vanmoof
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// TestCA is a locally generated certificate authority. Certificates it issues
+// are NOT accepted by real bikes; they exist for fixtures and reproducible
+// tests. Point the verifier at it with VerifyOptions{TrustStore: ca.TrustStore()}.
+type TestCA struct {
+	PrivateKey ed25519.PrivateKey
+}
+
+// NewTestCA generates a fresh CA keypair
+func NewTestCA() (*TestCA, error) {
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key pair: %w", err)
+	}
+	return &TestCA{PrivateKey: privKey}, nil
+}
+
+// TestCAFromPrivateKey loads a CA from a base64 Ed25519 private key
+// (64 bytes as printed by GenerateED25519, or a 32-byte seed)
+func TestCAFromPrivateKey(privKeyB64 string) (*TestCA, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(privKeyB64))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 CA private key: %w", err)
+	}
+	switch len(decoded) {
+	case ed25519.PrivateKeySize:
+		return &TestCA{PrivateKey: ed25519.PrivateKey(decoded)}, nil
+	case ed25519.SeedSize:
+		return &TestCA{PrivateKey: ed25519.NewKeyFromSeed(decoded)}, nil
+	default:
+		return nil, fmt.Errorf("CA private key must be %d or %d bytes, got %d", ed25519.PrivateKeySize, ed25519.SeedSize, len(decoded))
+	}
+}
+
+// PublicKey returns the CA's public key
+func (ca *TestCA) PublicKey() ed25519.PublicKey {
+	return ca.PrivateKey.Public().(ed25519.PublicKey)
+}
+
+// TrustStore returns a trust store containing only this CA
+func (ca *TestCA) TrustStore() *TrustStore {
+	return &TrustStore{CAs: []TrustedCA{{Label: "Test CA", PublicKey: ca.PublicKey()}}}
+}
+
+// Issue signs the payload with the CA key. Values are used as-is, so
+// expired, malformed or otherwise unusual certificates can be minted.
+func (ca *TestCA) Issue(payload CertificatePayload) ([]byte, error) {
+	return EncodeCertificate(payload, ca.PrivateKey)
+}
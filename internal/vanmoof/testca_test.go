@@ -0,0 +1,198 @@
+package vanmoof
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testNow is the reference time of the verification tests
+var testNow = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// testPayload returns a valid owner certificate payload for bike 1001
+func testPayload() CertificatePayload {
+	return CertificatePayload{
+		ID:        1001,
+		FrameID:   "SVTBKL00063OA",
+		BikeID:    "SVTBKL00063OA",
+		Expiry:    uint32(testNow.Add(7 * 24 * time.Hour).Unix()),
+		Role:      0x07,
+		UserID:    []byte{0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x41, 0x11, 0x91, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11},
+		PublicKey: make([]byte, 32),
+	}
+}
+
+// issueAndVerify mints payload with ca and verifies it with opts at testNow,
+// using ca as the trust store unless opts has one
+func issueAndVerify(t *testing.T, ca *TestCA, payload CertificatePayload, opts VerifyOptions) *VerifyReport {
+	t.Helper()
+	raw, err := ca.Issue(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.TrustStore == nil {
+		opts.TrustStore = ca.TrustStore()
+	}
+	opts.Now = testNow
+	report, err := CheckCertificate(base64.StdEncoding.EncodeToString(raw), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+// hasMessage reports whether one of messages contains substr
+func hasMessage(messages []string, substr string) bool {
+	for _, m := range messages {
+		if strings.Contains(m, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestCA(t *testing.T) *TestCA {
+	t.Helper()
+	ca, err := NewTestCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func TestVerifyValid(t *testing.T) {
+	ca := newTestCA(t)
+	report := issueAndVerify(t, ca, testPayload(), VerifyOptions{})
+	if !report.Valid() || len(report.Warnings) > 0 {
+		t.Fatalf("errors %q, warnings %q", report.Errors, report.Warnings)
+	}
+	if !report.SignatureVerified {
+		t.Error("signature not verified")
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+}
+
+func TestVerifyExpiry(t *testing.T) {
+	ca := newTestCA(t)
+	for _, tc := range []struct {
+		name    string
+		expiry  time.Time
+		expired bool
+		warning string
+	}{
+		{"valid", testNow.Add(time.Hour), false, ""},
+		{"expired", testNow.Add(-time.Hour), true, ""},
+		{"far future", testNow.Add(2 * 365 * 24 * time.Hour), false, "suspiciously far in the future"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := testPayload()
+			payload.Expiry = uint32(tc.expiry.Unix())
+			report := issueAndVerify(t, ca, payload, VerifyOptions{})
+			if report.Expired != tc.expired {
+				t.Errorf("Expired = %v, want %v", report.Expired, tc.expired)
+			}
+			if tc.expired && !errors.Is(report.Err(), ErrCertificateExpired) {
+				t.Errorf("Err() = %v, want ErrCertificateExpired", report.Err())
+			}
+			if tc.warning != "" && !hasMessage(report.Warnings, tc.warning) {
+				t.Errorf("warnings %q, want %q", report.Warnings, tc.warning)
+			}
+		})
+	}
+
+	// Expired plus another error is invalid, not merely expired
+	payload := testPayload()
+	payload.Expiry = uint32(testNow.Add(-time.Hour).Unix())
+	otherKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	report := issueAndVerify(t, ca, payload, VerifyOptions{PublicKey: otherKey})
+	if err := report.Err(); !errors.Is(err, ErrInvalidCertificate) || errors.Is(err, ErrCertificateExpired) {
+		t.Errorf("Err() = %v, want only ErrInvalidCertificate", err)
+	}
+}
+
+func TestVerifyRole(t *testing.T) {
+	ca := newTestCA(t)
+	for role, known := range map[uint8]bool{0x00: true, 0x01: true, 0x03: true, 0x07: true, 0x0B: true, 0x0F: true, 0x02: false, 0xFF: false} {
+		payload := testPayload()
+		payload.Role = role
+		report := issueAndVerify(t, ca, payload, VerifyOptions{})
+		if got := !hasMessage(report.Warnings, "Unknown role"); got != known {
+			t.Errorf("role %#x: known = %v, want %v (warnings %q)", role, got, known, report.Warnings)
+		}
+	}
+}
+
+func TestVerifyUserID(t *testing.T) {
+	ca := newTestCA(t)
+	payload := testPayload()
+
+	report := issueAndVerify(t, ca, payload, VerifyOptions{UserID: "11111111-1111-4111-9111-111111111111"})
+	if !report.UserIDVerified || !report.Valid() {
+		t.Errorf("matching UUID: verified %v, errors %q", report.UserIDVerified, report.Errors)
+	}
+
+	report = issueAndVerify(t, ca, payload, VerifyOptions{UserID: "22222222-2222-4222-9222-222222222222"})
+	if report.UserIDVerified || !hasMessage(report.Errors, "User ID mismatch") {
+		t.Errorf("other UUID: verified %v, errors %q", report.UserIDVerified, report.Errors)
+	}
+
+	// Version 0 is not a valid UUID version
+	payload.UserID = make([]byte, 16)
+	report = issueAndVerify(t, ca, payload, VerifyOptions{})
+	if !hasMessage(report.Warnings, "invalid version or variant") {
+		t.Errorf("warnings %q, want invalid UUID", report.Warnings)
+	}
+
+	payload.UserID = make([]byte, 15)
+	report = issueAndVerify(t, ca, payload, VerifyOptions{})
+	if !hasMessage(report.Errors, "Field 'u' has incorrect length") {
+		t.Errorf("errors %q, want incorrect length", report.Errors)
+	}
+}
+
+func TestVerifyBikeMatch(t *testing.T) {
+	ca := newTestCA(t)
+	bikes := []BikeData{
+		{BikeID: 1001, FrameNumber: "SVTBKL00063OA"},
+		{BikeID: 1002, FrameNumber: "TVSEF300106TA"},
+	}
+
+	for _, tc := range []struct {
+		bikeID   string
+		verified bool
+	}{
+		{"1001", true},
+		{"SVTBKL00063OA", true},
+		{"1002", false},
+		{"TVSEF300106TA", false},
+	} {
+		report := issueAndVerify(t, ca, testPayload(), VerifyOptions{BikeID: tc.bikeID, Bikes: bikes})
+		if report.BikeIDVerified != tc.verified {
+			t.Errorf("bike %s: verified = %v, want %v (errors %q)", tc.bikeID, report.BikeIDVerified, tc.verified, report.Errors)
+		}
+		if report.MatchedBike == nil || report.MatchedBike.BikeID != 1001 {
+			t.Errorf("bike %s: matched %+v, want bike 1001", tc.bikeID, report.MatchedBike)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	ca := newTestCA(t)
+	other := newTestCA(t)
+
+	report := issueAndVerify(t, ca, testPayload(), VerifyOptions{TrustStore: other.TrustStore()})
+	if report.SignatureVerified || !hasMessage(report.Errors, "Signature INVALID") {
+		t.Errorf("other CA: verified %v, errors %q", report.SignatureVerified, report.Errors)
+	}
+
+	revoked := ca.TrustStore()
+	revoked.CAs[0].Revoked = true
+	report = issueAndVerify(t, ca, testPayload(), VerifyOptions{TrustStore: revoked})
+	if report.SignatureVerified || !hasMessage(report.Errors, "Signature not trusted") {
+		t.Errorf("revoked CA: verified %v, errors %q", report.SignatureVerified, report.Errors)
+	}
+}
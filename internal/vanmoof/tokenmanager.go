@@ -0,0 +1,123 @@
+package vanmoof
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// appTokenRefreshWindow is how long before its expiry an app token is
+// replaced, so that a long run never sends an expired one
+const appTokenRefreshWindow = 5 * time.Minute
+
+// tokenManager holds the tokens of an authenticated account for the duration
+// of a run. It refreshes the app token before it expires, re-authenticates
+// once if the API rejects a token and keeps the token cache up to date,
+// including refresh tokens rotated by the API.
+type tokenManager struct {
+	email   string
+	noCache bool
+	tokens  CachedTokens
+	renewed bool // Tokens have been renewed after a 401; renewal happens at most once
+}
+
+// bearer selects the token that authorizes a request
+type bearer int
+
+const (
+	bearerAuthToken bearer = iota
+	bearerAppToken
+)
+
+// newTokenManager authenticates with the cached tokens or the password, see resolveTokens
+func (c *Client) newTokenManager(ctx context.Context, email string, noCache bool) (*tokenManager, error) {
+	var cached *CachedTokens
+	if !noCache {
+		cached = c.loadTokenCache(ctx, email)
+	}
+	tokens, err := c.resolveTokens(ctx, email, c.Password, noCache, cached)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenManager{email: email, noCache: noCache, tokens: tokens}, nil
+}
+
+// token returns the token of the given kind
+func (tm *tokenManager) token(kind bearer) string {
+	if kind == bearerAppToken {
+		return tm.tokens.AppToken
+	}
+	return tm.tokens.AuthToken
+}
+
+// doAuthorizedRequest sends a request authorized with a managed token. If
+// the server rejects the token (HTTP 401), for example because it was revoked
+// by a password change, the tokens are renewed once and the request is
+// retried with the new token.
+func (c *Client) doAuthorizedRequest(ctx context.Context, tm *tokenManager, kind bearer, method, url string, body []byte, headers map[string]string) ([]byte, error) {
+	if kind == bearerAppToken {
+		c.refreshExpiringAppToken(ctx, tm)
+	}
+
+	send := func() ([]byte, error) {
+		authorized := map[string]string{"Authorization": "Bearer " + tm.token(kind)}
+		for k, v := range headers {
+			authorized[k] = v
+		}
+		return c.doHTTPRequest(ctx, method, url, bytes.NewReader(body), authorized)
+	}
+
+	respBody, err := send()
+	if !errors.Is(err, ErrUnauthorized) || tm.renewed {
+		return respBody, err
+	}
+
+	c.log().Info("Token rejected, re-authenticating", "error", err)
+	if err := c.renew(ctx, tm, kind); err != nil {
+		return nil, fmt.Errorf("re-authentication failed: %w", err)
+	}
+	return send()
+}
+
+// refreshExpiringAppToken replaces the app token if it expires within
+// appTokenRefreshWindow. Failures are logged; the current token is still
+// used until it is rejected.
+func (c *Client) refreshExpiringAppToken(ctx context.Context, tm *tokenManager) {
+	expiry, err := jwtExpiry(tm.tokens.AppToken)
+	if err != nil || expiry.IsZero() || time.Until(expiry) > appTokenRefreshWindow {
+		return
+	}
+
+	c.log().Debug("App token expires soon, refreshing", "expires_in", time.Until(expiry).Round(time.Second).String())
+	appToken, err := c.getApplicationToken(ctx, tm.tokens.AuthToken)
+	if err != nil || appToken == "" {
+		c.log().Debug("Failed to refresh app token", "error", err)
+		return
+	}
+	tm.tokens.AppToken = appToken
+	if !tm.noCache {
+		c.saveTokenCache(ctx, tm.email, tm.tokens)
+	}
+}
+
+// renew walks the token ladder again without the rejected token, and any
+// token derived from it, and updates the managed tokens and the token cache
+func (c *Client) renew(ctx context.Context, tm *tokenManager, rejected bearer) error {
+	tm.renewed = true
+
+	// The app token is either the rejected one or was issued for the rejected auth token
+	stale := tm.tokens
+	stale.AppToken = ""
+	if rejected == bearerAuthToken {
+		stale.AuthToken = ""
+	}
+
+	tokens, err := c.resolveTokens(ctx, tm.email, c.Password, tm.noCache, &stale)
+	if err != nil {
+		return err
+	}
+	tm.tokens = tokens
+	return nil
+}
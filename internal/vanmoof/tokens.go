@@ -1,256 +1,432 @@
 package vanmoof
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/sha256"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/pbkdf2"
 )
 
-const tokenCacheDir = ".vanmoof-certificates"
 const tokenCacheFile = "tokens.json"
-const pbkdf2Iterations = 100_000
-const saltSize = 16
-const nonceSize = 12
+const tokenCacheBackupSuffix = ".bak"
 
-// tokenCachePath returns the full path to the token cache file
-func tokenCachePath() (string, error) {
-	home, err := os.UserHomeDir()
+// TokenCachePath returns the full path to the token cache file, see DefaultPaths
+func TokenCachePath() (string, error) {
+	p, err := DefaultPaths()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, tokenCacheDir, tokenCacheFile), nil
+	return p.TokenCache(), nil
 }
 
-// getCacheKey returns the encryption key from VANMOOF_CACHE_KEY env var, or empty if unset
-func getCacheKey() string {
-	return os.Getenv("VANMOOF_CACHE_KEY")
+// FileTokenStore keeps the tokens of all accounts in one JSON file, the
+// default token store. Updates are serialized with a lock file, so several
+// processes can share it, and the replaced file is kept as a backup.
+type FileTokenStore struct {
+	Path   string       // Empty uses TokenCachePath()
+	Key    string       // Encrypts the file; empty stores plain JSON
+	Logger *slog.Logger // nil disables logging
 }
 
-// encrypt encrypts plaintext with AES-256-GCM using a key derived from passphrase
-// Format: [16 bytes salt][12 bytes nonce][ciphertext + GCM tag]
-func encrypt(plaintext []byte, passphrase string) ([]byte, error) {
-	salt := make([]byte, saltSize)
-	if _, err := rand.Read(salt); err != nil {
-		return nil, err
+// path returns the location of the cache file
+func (s *FileTokenStore) path() (string, error) {
+	if s.Path != "" {
+		return s.Path, nil
 	}
+	return TokenCachePath()
+}
 
-	key := pbkdf2.Key([]byte(passphrase), salt, pbkdf2Iterations, 32, sha256.New)
+// log returns the logger to write to
+func (s *FileTokenStore) log() *slog.Logger {
+	if s.Logger == nil {
+		return discardLogger
+	}
+	return s.Logger
+}
 
-	block, err := aes.NewCipher(key)
+// lock takes the lock serializing read-modify-write cycles of the cache file
+func (s *FileTokenStore) lock() (func(), error) {
+	path, err := s.path()
 	if err != nil {
 		return nil, err
 	}
+	return lockTokenCache(path, s.log())
+}
 
-	gcm, err := cipher.NewGCM(block)
+// Load returns the cached tokens of email, or nil if there are none
+func (s *FileTokenStore) Load(ctx context.Context, email string) (*CachedTokens, error) {
+	cache, err := s.load()
 	if err != nil {
 		return nil, err
 	}
-
-	nonce := make([]byte, nonceSize)
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, err
+	tokens, ok := cache.tokens[email]
+	if !ok {
+		return nil, nil
 	}
+	return &tokens, nil
+}
 
-	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+// Store saves the tokens of email, preserving other accounts. A cache that
+// cannot be read, e.g. because Key is wrong, is left alone and an error is
+// returned, as replacing it would lose the other accounts.
+func (s *FileTokenStore) Store(ctx context.Context, email string, tokens CachedTokens) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	// salt + nonce + ciphertext
-	result := make([]byte, 0, saltSize+nonceSize+len(ciphertext))
-	result = append(result, salt...)
-	result = append(result, nonce...)
-	result = append(result, ciphertext...)
-	return result, nil
+	cache, err := s.load()
+	if err != nil {
+		return fmt.Errorf("not overwriting unreadable token cache: %w", err)
+	}
+	cache.tokens[email] = tokens
+	return s.save(cache)
 }
 
-// decrypt decrypts data produced by encrypt
-func decrypt(data []byte, passphrase string) ([]byte, error) {
-	if len(data) < saltSize+nonceSize+aes.BlockSize {
-		return nil, fmt.Errorf("encrypted data too short")
+// Erase removes the tokens of email, keeping the other accounts. The backup
+// of the cache is deleted as it still holds the removed tokens.
+func (s *FileTokenStore) Erase(ctx context.Context, email string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	salt := data[:saltSize]
-	nonce := data[saltSize : saltSize+nonceSize]
-	ciphertext := data[saltSize+nonceSize:]
-
-	key := pbkdf2.Key([]byte(passphrase), salt, pbkdf2Iterations, 32, sha256.New)
+	cache, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := cache.tokens[email]; !ok {
+		return nil
+	}
+	delete(cache.tokens, email)
+	if err := s.save(cache); err != nil {
+		return err
+	}
+	return s.removeFile(tokenCacheBackupSuffix)
+}
 
-	block, err := aes.NewCipher(key)
+// List returns the cached tokens of all accounts
+func (s *FileTokenStore) List(ctx context.Context) (map[string]CachedTokens, error) {
+	cache, err := s.load()
 	if err != nil {
 		return nil, err
 	}
+	return cache.tokens, nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// Purge deletes the cache file and its backup. A cache that cannot be read,
+// for example because the key was lost, is deleted as well and no tokens are
+// returned.
+func (s *FileTokenStore) Purge(ctx context.Context) (map[string]CachedTokens, error) {
+	unlock, err := s.lock()
 	if err != nil {
 		return nil, err
 	}
+	defer unlock()
 
-	return gcm.Open(nil, nonce, ciphertext, nil)
+	var cacheMap map[string]CachedTokens
+	if cache, err := s.load(); err != nil {
+		s.log().Warn("Deleting unreadable token cache", "error", err)
+	} else {
+		cacheMap = cache.tokens
+	}
+
+	for _, suffix := range []string{"", tokenCacheBackupSuffix} {
+		if err := s.removeFile(suffix); err != nil {
+			return nil, err
+		}
+	}
+	s.log().Debug("Token cache deleted")
+	return cacheMap, nil
 }
 
-// loadAllTokenCaches loads the full cache map from disk
-func loadAllTokenCaches(debug bool) map[string]CachedTokens {
-	path, err := tokenCachePath()
+// tokenCache is the content of the cache file as read by load
+type tokenCache struct {
+	tokens   map[string]CachedTokens
+	readable bool      // The cache file itself was read, so it is a good backup
+	key      *cacheKey // Key derived while reading, reused by save
+}
+
+// load reads the full cache map from disk. A missing cache is an empty map;
+// a cache that cannot be decrypted or parsed is an error, unless the backup
+// of the last good cache can be read instead.
+func (s *FileTokenStore) load() (*tokenCache, error) {
+	path, err := s.path()
 	if err != nil {
-		if debug {
-			fmt.Printf("[DEBUG] Token cache path error: %v\n", err)
+		return nil, err
+	}
+
+	cache, err := s.readFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.log().Debug("No token cache found", "path", path)
+		return &tokenCache{tokens: map[string]CachedTokens{}}, nil
+	} else if err != nil {
+		backup, backupErr := s.readFile(path + tokenCacheBackupSuffix)
+		if backupErr != nil {
+			return nil, err
 		}
-		return nil
+		s.log().Warn("Token cache unreadable, using backup of the last good cache", "error", err)
+		return backup, nil
 	}
+	cache.readable = true
+	return cache, nil
+}
 
+// readFile reads and, if a key is set, decrypts a token cache file
+func (s *FileTokenStore) readFile(path string) (*tokenCache, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		if debug {
-			fmt.Printf("[DEBUG] No token cache found: %v\n", err)
-		}
-		return nil
+		return nil, err
+	}
+	s.log().Debug("Token cache read", "path", path, "encryption", cacheEncryption(data))
+	cacheMap, key, err := decodeTokenCache(data, s.Key)
+	if err != nil {
+		return nil, err
 	}
+	return &tokenCache{tokens: cacheMap, key: key}, nil
+}
 
-	// Decrypt if cache key is set
-	if key := getCacheKey(); key != "" {
-		plaintext, err := decrypt(data, key)
-		if err != nil {
-			if debug {
-				fmt.Printf("[DEBUG] Token cache decryption failed: %v\n", err)
-			}
-			return nil
-		}
-		data = plaintext
-		if debug {
-			fmt.Println("[DEBUG] Token cache decrypted")
-		}
+// save writes the cache map to disk, keeping the file it replaces as a
+// backup if load could read it. Callers hold the lock.
+func (s *FileTokenStore) save(cache *tokenCache) error {
+	path, err := s.path()
+	if err != nil {
+		return err
 	}
 
-	var cacheMap map[string]CachedTokens
-	if err := json.Unmarshal(data, &cacheMap); err != nil {
-		if debug {
-			fmt.Printf("[DEBUG] Token cache parse error: %v\n", err)
+	if err := ensureTokenCacheDir(path); err != nil {
+		return err
+	}
+
+	data, err := encodeTokenCache(cache.tokens, s.Key, cache.key)
+	if err != nil {
+		return err
+	}
+
+	if cache.readable {
+		if err := copyFileAtomic(path, path+tokenCacheBackupSuffix); err != nil {
+			s.log().Warn("Failed to back up token cache", "error", err)
 		}
-		return nil
 	}
 
-	return cacheMap
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+
+	s.log().Debug("Token cache saved to disk")
+	return nil
 }
 
-// saveAllTokenCaches writes the full cache map to disk
-func saveAllTokenCaches(cacheMap map[string]CachedTokens, debug bool) {
-	path, err := tokenCachePath()
+// removeFile deletes the cache file with the given suffix, if it exists
+func (s *FileTokenStore) removeFile(suffix string) error {
+	path, err := s.path()
 	if err != nil {
-		if debug {
-			fmt.Printf("[DEBUG] Token cache path error: %v\n", err)
-		}
-		return
+		return err
 	}
-
-	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
-		if debug {
-			fmt.Printf("[DEBUG] Failed to create token cache dir: %v\n", err)
-		}
-		return
+	if err := os.Remove(path + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
 	}
+	return nil
+}
 
-	data, err := json.MarshalIndent(cacheMap, "", "  ")
+// Rekey re-encrypts the cache file with newKey in the current format and
+// returns a description of its new encryption. An empty key means plaintext.
+// This also upgrades legacy caches and encrypts plaintext ones, which are
+// read whether or not Key is set. Key is
+// set to newKey. The backup, which only the old key can decrypt, is deleted.
+func (s *FileTokenStore) Rekey(newKey string) (string, error) {
+	unlock, err := s.lock()
 	if err != nil {
-		if debug {
-			fmt.Printf("[DEBUG] Token cache marshal error: %v\n", err)
-		}
-		return
+		return "", err
 	}
+	defer unlock()
 
-	// Encrypt if cache key is set
-	if key := getCacheKey(); key != "" {
-		encrypted, err := encrypt(data, key)
-		if err != nil {
-			if debug {
-				fmt.Printf("[DEBUG] Token cache encryption failed: %v\n", err)
-			}
-			return
-		}
-		data = encrypted
-		if debug {
-			fmt.Println("[DEBUG] Token cache encrypted")
-		}
+	path, err := s.path()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", errors.New("no token cache to rekey")
+	} else if err != nil {
+		return "", err
 	}
+	s.log().Debug("Token cache read", "path", path, "encryption", cacheEncryption(data))
 
-	if err := os.WriteFile(path, data, 0600); err != nil {
-		if debug {
-			fmt.Printf("[DEBUG] Failed to write token cache: %v\n", err)
-		}
-		return
+	// Rekey is how a plaintext cache gets encrypted, so it is read even with a key set
+	oldKey := s.Key
+	if json.Valid(data) {
+		oldKey = ""
+	}
+	cacheMap, _, err := decodeTokenCache(data, oldKey)
+	if err != nil {
+		return "", err
+	}
+	if data, err = encodeTokenCache(cacheMap, newKey, nil); err != nil {
+		return "", err
 	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", fmt.Errorf("failed to write token cache: %w", err)
+	}
+	s.Key = newKey
+	if err := s.removeFile(tokenCacheBackupSuffix); err != nil {
+		return "", err
+	}
+	return cacheEncryption(data), nil
+}
 
-	if debug {
-		fmt.Println("[DEBUG] Token cache saved to disk")
+// ensureTokenCacheDir creates the directory of the token cache
+func ensureTokenCacheDir(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create token cache dir: %w", err)
 	}
+	return nil
 }
 
-// loadTokenCache loads cached tokens from disk for the given email
-func loadTokenCache(email string, debug bool) *CachedTokens {
-	cacheMap := loadAllTokenCaches(debug)
-	if cacheMap == nil {
-		return nil
+// writeFileAtomic replaces path with data via a temporary file in the same
+// directory, so an interrupted write or a crash never leaves a truncated file
+// behind. Data and rename are synced to disk before it returns.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
 	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename
 
-	cached, ok := cacheMap[email]
-	if !ok {
-		if debug {
-			fmt.Printf("[DEBUG] No cached tokens for %s\n", email)
-		}
-		return nil
+	// CreateTemp creates the file with mode 0600
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
 	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
 
-	if debug {
-		fmt.Printf("[DEBUG] Loaded token cache for %s\n", email)
+// copyFileAtomic replaces dst with a copy of src
+func copyFileAtomic(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
 	}
-	return &cached
+	return writeFileAtomic(dst, data)
 }
 
-// saveTokenCache saves tokens to disk for the given email, preserving other accounts
-func saveTokenCache(email, authToken, refreshToken, appToken string, debug bool) {
-	// Load existing cache to preserve other accounts
-	cacheMap := loadAllTokenCaches(debug)
-	if cacheMap == nil {
-		cacheMap = make(map[string]CachedTokens)
+// syncDir flushes a directory so a rename in it survives a crash. Not all
+// platforms support this (Windows cannot open directories), so it is best effort.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
 	}
+	d.Sync()
+	d.Close()
+}
 
-	cacheMap[email] = CachedTokens{
-		AuthToken:    authToken,
-		AppToken:     appToken,
-		RefreshToken: refreshToken,
+// loadTokenCache loads the cached tokens of email from the token store
+func (c *Client) loadTokenCache(ctx context.Context, email string) *CachedTokens {
+	cached, err := c.tokenStore().Load(ctx, email)
+	if err != nil {
+		c.log().Warn("Failed to load token cache", "error", err)
+		return nil
+	}
+	if cached == nil {
+		c.log().Debug("No cached tokens", "email", email)
+		return nil
 	}
 
-	saveAllTokenCaches(cacheMap, debug)
+	c.log().Debug("Loaded token cache", "email", email)
+	return cached
+}
+
+// saveTokenCache saves the tokens of email to the token store
+func (c *Client) saveTokenCache(ctx context.Context, email string, tokens CachedTokens) {
+	if err := c.tokenStore().Store(ctx, email, tokens); err != nil {
+		c.log().Warn("Failed to save token cache", "error", err)
+	}
 }
 
 // isJWTExpired checks if a JWT token is expired (with 60s buffer)
 func isJWTExpired(tokenString string) bool {
-	if tokenString == "" {
+	expiry, err := jwtExpiry(tokenString)
+	if err != nil || expiry.IsZero() {
 		return true
 	}
 
-	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
-	token, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
+	// Expired if within 60 seconds of expiry
+	return time.Now().Unix() >= expiry.Unix()-60
+}
+
+// jwtExpiry returns the exp claim of a JWT, or the zero time if it has none
+func jwtExpiry(tokenString string) (time.Time, error) {
+	token, err := parseJWT(tokenString)
 	if err != nil {
-		return true
+		return time.Time{}, err
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return true
+	exp, err := token.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}, err
 	}
+	return exp.Time, nil
+}
 
-	exp, ok := claims["exp"].(float64)
-	if !ok {
-		return true
+// TokenStatus describes a cached token
+type TokenStatus struct {
+	Cached bool      `json:"cached"`
+	Expiry time.Time `json:"expires_at,omitzero"` // Zero if the token is not a JWT or does not expire
+}
+
+// AccountTokenStatus describes the cached tokens of one account
+type AccountTokenStatus struct {
+	Email        string      `json:"email"`
+	AuthToken    TokenStatus `json:"auth_token"`
+	AppToken     TokenStatus `json:"app_token"`
+	RefreshToken TokenStatus `json:"refresh_token"`
+}
+
+// TokenCacheStatus returns the stored tokens of every account, sorted by email
+func TokenCacheStatus(ctx context.Context, store TokenStore) ([]AccountTokenStatus, error) {
+	cacheMap, err := listTokens(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]AccountTokenStatus, 0, len(cacheMap))
+	for email, tokens := range cacheMap {
+		status = append(status, AccountTokenStatus{
+			Email:        email,
+			AuthToken:    tokenStatus(tokens.AuthToken),
+			AppToken:     tokenStatus(tokens.AppToken),
+			RefreshToken: tokenStatus(tokens.RefreshToken),
+		})
 	}
+	slices.SortFunc(status, func(a, b AccountTokenStatus) int { return strings.Compare(a.Email, b.Email) })
+	return status, nil
+}
 
-	// Expired if within 60 seconds of expiry
-	return time.Now().Unix() >= int64(exp)-60
+// tokenStatus describes a token from the cache
+func tokenStatus(token string) TokenStatus {
+	if token == "" {
+		return TokenStatus{}
+	}
+	expiry, _ := jwtExpiry(token)
+	return TokenStatus{Cached: true, Expiry: expiry}
 }
@@ -0,0 +1,209 @@
+package vanmoof
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Environment of the helper process started by TestFileTokenStoreConcurrentProcesses
+const (
+	helperCacheEnv   = "VANMOOF_TEST_HELPER_CACHE"
+	helperAccountEnv = "VANMOOF_TEST_HELPER_ACCOUNT"
+)
+
+const accountsPerWriter = 20
+
+func testTokens(email string, i int) CachedTokens {
+	return CachedTokens{AuthToken: fmt.Sprintf("auth-%s-%d", email, i), RefreshToken: "refresh-" + email}
+}
+
+// storeAccounts stores accountsPerWriter accounts named after writer
+func storeAccounts(t testing.TB, s *FileTokenStore, writer string) {
+	for i := range accountsPerWriter {
+		email := fmt.Sprintf("%s-%d@example.com", writer, i)
+		if err := s.Store(context.Background(), email, testTokens(email, i)); err != nil {
+			t.Errorf("Store(%s): %v", email, err)
+			return
+		}
+	}
+}
+
+// checkAccounts verifies that the cache holds exactly the accounts of writers
+func checkAccounts(t *testing.T, s *FileTokenStore, writers []string) {
+	t.Helper()
+	cacheMap, err := s.List(context.Background())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if want := len(writers) * accountsPerWriter; len(cacheMap) != want {
+		t.Errorf("cache has %d accounts, want %d", len(cacheMap), want)
+	}
+	for _, writer := range writers {
+		for i := range accountsPerWriter {
+			email := fmt.Sprintf("%s-%d@example.com", writer, i)
+			if got, want := cacheMap[email], testTokens(email, i); got != want {
+				t.Errorf("tokens of %s = %+v, want %+v", email, got, want)
+			}
+		}
+	}
+}
+
+func TestFileTokenStoreConcurrentGoroutines(t *testing.T) {
+	s := &FileTokenStore{Path: filepath.Join(t.TempDir(), "tokens.json")}
+
+	var writers []string
+	var wg sync.WaitGroup
+	for w := range 8 {
+		writer := fmt.Sprintf("goroutine%d", w)
+		writers = append(writers, writer)
+		wg.Go(func() { storeAccounts(t, s, writer) })
+	}
+	// Readers never see a partial file
+	for range 4 {
+		wg.Go(func() {
+			for range accountsPerWriter {
+				if _, err := s.List(context.Background()); err != nil {
+					t.Errorf("List during writes: %v", err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	checkAccounts(t, s, writers)
+}
+
+func TestFileTokenStoreConcurrentProcesses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts processes")
+	}
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	var writers []string
+	var cmds []*exec.Cmd
+	for p := range 6 {
+		writer := fmt.Sprintf("process%d", p)
+		writers = append(writers, writer)
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcessStore$")
+		cmd.Env = append(os.Environ(), helperCacheEnv+"="+path, helperAccountEnv+"="+writer)
+		var out bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &out, &out
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+		t.Cleanup(func() {
+			if t.Failed() {
+				t.Logf("%s output:\n%s", writer, out.String())
+			}
+		})
+	}
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("%s: %v", writers[i], err)
+		}
+	}
+
+	checkAccounts(t, &FileTokenStore{Path: path}, writers)
+}
+
+// TestHelperProcessStore is run by TestFileTokenStoreConcurrentProcesses in
+// separate processes
+func TestHelperProcessStore(t *testing.T) {
+	path := os.Getenv(helperCacheEnv)
+	if path == "" {
+		t.Skip("helper process")
+	}
+	storeAccounts(t, &FileTokenStore{Path: path}, os.Getenv(helperAccountEnv))
+}
+
+func TestFileTokenStoreWrongKeyKeepsCache(t *testing.T) {
+	useFastKDF(t)
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	ctx := context.Background()
+
+	good := &FileTokenStore{Path: path, Key: "right"}
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if err := good.Store(ctx, email, testTokens(email, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every run with a mistyped key fails to store and changes nothing
+	wrong := &FileTokenStore{Path: path, Key: "wrong"}
+	for run := range 2 {
+		if err := wrong.Store(ctx, "c@example.com", testTokens("c@example.com", 0)); err == nil {
+			t.Fatalf("run %d: Store with the wrong key succeeded", run)
+		}
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("cache file changed after Store with the wrong key")
+	}
+
+	cacheMap, err := good.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cacheMap) != 2 {
+		t.Errorf("cache has %d accounts after wrong key runs, want 2", len(cacheMap))
+	}
+}
+
+func TestFileTokenStoreBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	ctx := context.Background()
+	s := &FileTokenStore{Path: path}
+
+	for i := range 2 {
+		if err := s.Store(ctx, "a@example.com", testTokens("a@example.com", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, []byte("{truncated"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backup holds the cache before the last save
+	cached, err := s.Load(ctx, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testTokens("a@example.com", 0); cached == nil || *cached != want {
+		t.Fatalf("Load = %+v, want %+v from the backup", cached, want)
+	}
+
+	// Saving over the corrupt file restores it without losing the good backup
+	if err := s.Store(ctx, "b@example.com", testTokens("b@example.com", 0)); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := (&FileTokenStore{Path: path + tokenCacheBackupSuffix}).List(ctx)
+	if err != nil {
+		t.Fatalf("backup unreadable: %v", err)
+	}
+	if len(backup) != 1 {
+		t.Errorf("backup has %d accounts, want 1", len(backup))
+	}
+}
+
+// useFastKDF makes new cache files use cheap Argon2id parameters for the
+// duration of the test
+func useFastKDF(t *testing.T) {
+	saved := defaultKDF
+	defaultKDF = kdfParams{id: kdfArgon2id, iterations: 1, memory: 64, threads: 1}
+	t.Cleanup(func() { defaultKDF = saved })
+}
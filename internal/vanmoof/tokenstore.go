@@ -0,0 +1,118 @@
+package vanmoof
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"sync"
+)
+
+// TokenStore persists the tokens of accounts between runs. Implementations
+// must be safe for concurrent use.
+type TokenStore interface {
+	// Load returns the stored tokens of email, or nil if there are none
+	Load(ctx context.Context, email string) (*CachedTokens, error)
+	// Store saves the tokens of email, replacing any stored before
+	Store(ctx context.Context, email string, tokens CachedTokens) error
+	// Erase removes the tokens of email; an account without tokens is not an error
+	Erase(ctx context.Context, email string) error
+}
+
+// TokenLister is implemented by token stores that can enumerate their accounts
+type TokenLister interface {
+	// List returns the stored tokens of all accounts, keyed by email
+	List(ctx context.Context) (map[string]CachedTokens, error)
+}
+
+// TokenPurger is implemented by token stores that can remove all accounts at once
+type TokenPurger interface {
+	// Purge removes the tokens of all accounts and returns them, keyed by email
+	Purge(ctx context.Context) (map[string]CachedTokens, error)
+}
+
+// tokenStore returns the store for cached tokens: TokenStore, or a
+// FileTokenStore at TokenCachePath() encrypted with VANMOOF_CACHE_KEY
+func (c *Client) tokenStore() TokenStore {
+	if c.TokenStore != nil {
+		return c.TokenStore
+	}
+	return &FileTokenStore{Key: os.Getenv("VANMOOF_CACHE_KEY"), Logger: c.log()}
+}
+
+// listTokens returns the tokens of all accounts if the store can list them
+func listTokens(ctx context.Context, store TokenStore) (map[string]CachedTokens, error) {
+	lister, ok := store.(TokenLister)
+	if !ok {
+		return nil, errors.New("token store cannot list accounts")
+	}
+	return lister.List(ctx)
+}
+
+// purgeListed lists the accounts of store and erases them one by one
+func purgeListed(ctx context.Context, store TokenStore) (map[string]CachedTokens, error) {
+	cacheMap, err := listTokens(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	for email := range cacheMap {
+		if err := store.Erase(ctx, email); err != nil {
+			return nil, err
+		}
+	}
+	return cacheMap, nil
+}
+
+// MemoryTokenStore keeps tokens in memory, e.g. to share them between the
+// clients of a long-running process without touching the disk. The zero
+// value is an empty store.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]CachedTokens
+}
+
+// Load returns the stored tokens of email, or nil if there are none
+func (s *MemoryTokenStore) Load(ctx context.Context, email string) (*CachedTokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, ok := s.tokens[email]
+	if !ok {
+		return nil, nil
+	}
+	return &tokens, nil
+}
+
+// Store saves the tokens of email
+func (s *MemoryTokenStore) Store(ctx context.Context, email string, tokens CachedTokens) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = make(map[string]CachedTokens)
+	}
+	s.tokens[email] = tokens
+	return nil
+}
+
+// Erase removes the tokens of email
+func (s *MemoryTokenStore) Erase(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, email)
+	return nil
+}
+
+// List returns the stored tokens of all accounts
+func (s *MemoryTokenStore) List(ctx context.Context) (map[string]CachedTokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.tokens), nil
+}
+
+// Purge removes all accounts and returns their tokens
+func (s *MemoryTokenStore) Purge(ctx context.Context) (map[string]CachedTokens, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := s.tokens
+	s.tokens = nil
+	return tokens, nil
+}
@@ -0,0 +1,183 @@
+package vanmoof
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Environment of the helper process run by the CommandTokenStore under test
+const helperStoreEnv = "VANMOOF_TEST_HELPER_STORE"
+
+// testStores returns a new empty instance of every built-in token store
+func testStores(t *testing.T) map[string]TokenStore {
+	dir := t.TempDir()
+	t.Setenv(helperStoreEnv, filepath.Join(dir, "helper.json"))
+	return map[string]TokenStore{
+		"memory":  &MemoryTokenStore{},
+		"file":    &FileTokenStore{Path: filepath.Join(dir, "tokens.json")},
+		"dir":     &DirTokenStore{Dir: filepath.Join(dir, "accounts")},
+		"command": &CommandTokenStore{Command: []string{os.Args[0], "-test.run=^TestHelperCommandStore$", "--"}},
+	}
+}
+
+func TestTokenStoresListAndPurge(t *testing.T) {
+	ctx := context.Background()
+	emails := []string{"a@example.com", "b@example.com"}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := store.(TokenLister); !ok {
+				t.Fatal("does not implement TokenLister")
+			}
+			if _, ok := store.(TokenPurger); !ok {
+				t.Fatal("does not implement TokenPurger")
+			}
+
+			for i, email := range emails {
+				if err := store.Store(ctx, email, testTokens(email, i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			status, err := TokenCacheStatus(ctx, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(status) != len(emails) || status[0].Email != emails[0] {
+				t.Errorf("status = %+v, want %d accounts", status, len(emails))
+			}
+
+			cacheMap, err := PurgeTokenCache(ctx, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, email := range emails {
+				if got, want := cacheMap[email], testTokens(email, i); got != want {
+					t.Errorf("purged tokens of %s = %+v, want %+v", email, got, want)
+				}
+			}
+			if left, err := store.(TokenLister).List(ctx); err != nil || len(left) != 0 {
+				t.Errorf("after purge List = %v, %v; want no accounts", left, err)
+			}
+		})
+	}
+}
+
+func TestDirTokenStorePurgeUnreadable(t *testing.T) {
+	useFastKDF(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := (&DirTokenStore{Dir: dir, Key: "lost"}).Store(ctx, "a@example.com", testTokens("a@example.com", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheMap, err := (&DirTokenStore{Dir: dir, Key: "other"}).Purge(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cacheMap) != 0 {
+		t.Errorf("Purge returned %v from an unreadable file", cacheMap)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left after Purge", len(entries))
+	}
+}
+
+func TestDirTokenStoreEmailCase(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := &DirTokenStore{Dir: dir}
+	if err := store.Store(ctx, "A@Example.com", testTokens("A@Example.com", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := store.Load(ctx, "a@example.com"); err != nil || cached == nil || *cached != testTokens("A@Example.com", 0) {
+		t.Errorf("Load in lower case = %+v, %v", cached, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 || entries[0].Name() != "a@example.com.json" {
+		t.Errorf("files %v, want a@example.com.json", entries)
+	}
+
+	// Files of earlier versions kept the case of the email
+	legacy := testTokens("B@Example.com", 1)
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "B@Example.com.json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := store.Load(ctx, "B@Example.com"); err != nil || cached == nil || *cached != legacy {
+		t.Errorf("Load of a legacy file = %+v, %v", cached, err)
+	}
+	if err := store.Erase(ctx, "B@Example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := store.Load(ctx, "B@Example.com"); err != nil || cached != nil {
+		t.Errorf("Load after Erase = %+v, %v", cached, err)
+	}
+}
+
+func TestCommandTokenStoreWithoutList(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	store := &CommandTokenStore{Command: []string{"sh", "-c", `[ "$0" != list ] || { echo "unknown operation" >&2; exit 1; }`}}
+	if _, err := PurgeTokenCache(context.Background(), store); err == nil {
+		t.Error("PurgeTokenCache succeeded without list")
+	}
+}
+
+// TestHelperCommandStore is run by the CommandTokenStore of testStores as
+// its helper, keeping the accounts in the JSON file named by helperStoreEnv
+func TestHelperCommandStore(t *testing.T) {
+	path := os.Getenv(helperStoreEnv)
+	if path == "" {
+		t.Skip("helper process")
+	}
+	if err := runHelperCommandStore(path, os.Args[len(os.Args)-1]); err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(1)
+	}
+	os.Exit(0) // Keep the test output off stdout
+}
+
+func runHelperCommandStore(path, op string) error {
+	cacheMap := make(map[string]CachedTokens)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &cacheMap)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var req commandStoreRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		return err
+	}
+
+	switch op {
+	case "get":
+		if tokens, ok := cacheMap[req.Email]; ok {
+			return json.NewEncoder(os.Stdout).Encode(tokens)
+		}
+		return nil
+	case "list":
+		return json.NewEncoder(os.Stdout).Encode(cacheMap)
+	case "store":
+		cacheMap[req.Email] = *req.CachedTokens
+	case "erase":
+		delete(cacheMap, req.Email)
+	default:
+		return errors.New("unknown operation " + op)
+	}
+	data, err = json.Marshal(cacheMap)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
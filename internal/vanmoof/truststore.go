@@ -0,0 +1,147 @@
+package vanmoof
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const trustStoreFile = "truststore.json"
+
+// TrustedCA is a certificate signing key trusted by the verifier
+type TrustedCA struct {
+	Label     string
+	PublicKey ed25519.PublicKey
+	NotBefore time.Time // Zero means no lower bound
+	NotAfter  time.Time // Zero means no upper bound
+	Revoked   bool
+}
+
+// TrustStore is the set of CA keys certificate signatures are verified against
+type TrustStore struct {
+	CAs []TrustedCA
+}
+
+// trustStoreJSON is the on-disk trust store format
+type trustStoreJSON struct {
+	Keys []struct {
+		Label     string    `json:"label"`
+		PublicKey string    `json:"public_key"` // hex or base64
+		NotBefore time.Time `json:"not_before,omitzero"`
+		NotAfter  time.Time `json:"not_after,omitzero"`
+		Revoked   bool      `json:"revoked,omitempty"`
+	} `json:"keys"`
+}
+
+// KeyID returns a short identifier for the CA key (first 8 bytes of its SHA-256, hex)
+func (ca *TrustedCA) KeyID() string {
+	sum := sha256.Sum256(ca.PublicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// String returns the label and key ID, e.g. "VanMoof BLE certificate CA (1a2b...)"
+func (ca *TrustedCA) String() string {
+	if ca.Label == "" {
+		return ca.KeyID()
+	}
+	return fmt.Sprintf("%s (%s)", ca.Label, ca.KeyID())
+}
+
+// verify reports whether the CA key signed payload. A key of the wrong
+// length, e.g. from a TrustedCA built by hand, verifies nothing.
+func (ca *TrustedCA) verify(payload, signature []byte) bool {
+	return len(ca.PublicKey) == ed25519.PublicKeySize && ed25519.Verify(ca.PublicKey, payload, signature)
+}
+
+// checkValidity reports why the CA must not be trusted at the given time, or nil
+func (ca *TrustedCA) checkValidity(at time.Time) error {
+	if ca.Revoked {
+		return fmt.Errorf("CA key %s is revoked", ca)
+	}
+	if !ca.NotBefore.IsZero() && at.Before(ca.NotBefore) {
+		return fmt.Errorf("CA key %s is not valid before %s", ca, ca.NotBefore.Format("2006-01-02 15:04:05 MST"))
+	}
+	if !ca.NotAfter.IsZero() && at.After(ca.NotAfter) {
+		return fmt.Errorf("CA key %s expired at %s", ca, ca.NotAfter.Format("2006-01-02 15:04:05 MST"))
+	}
+	return nil
+}
+
+// DefaultTrustStore returns a trust store containing VanMoof's known CA keys
+func DefaultTrustStore() *TrustStore {
+	s := &TrustStore{}
+	for _, known := range knownCAKeys {
+		pubKeyBytes, err := hex.DecodeString(known.keyHex)
+		if err != nil || len(pubKeyBytes) != ed25519.PublicKeySize {
+			continue
+		}
+		s.Add(TrustedCA{Label: known.label, PublicKey: ed25519.PublicKey(pubKeyBytes)})
+	}
+	return s
+}
+
+// Add adds a CA to the store, replacing any entry with the same public key
+func (s *TrustStore) Add(ca TrustedCA) {
+	for i := range s.CAs {
+		if bytes.Equal(s.CAs[i].PublicKey, ca.PublicKey) {
+			s.CAs[i] = ca
+			return
+		}
+	}
+	s.CAs = append(s.CAs, ca)
+}
+
+// LoadTrustStore returns the built-in VanMoof keys extended with the entries
+// from the trust store file at path. An entry for a built-in key replaces it,
+// which allows revoking or time-limiting the built-in key.
+func LoadTrustStore(path string) (*TrustStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file trustStoreJSON
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid trust store %s: %w", path, err)
+	}
+
+	s := DefaultTrustStore()
+	for i, entry := range file.Keys {
+		pubKey, err := ParseCAPublicKey(entry.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trust store %s: key %d: %w", path, i+1, err)
+		}
+		s.Add(TrustedCA{
+			Label:     entry.Label,
+			PublicKey: pubKey,
+			NotBefore: entry.NotBefore,
+			NotAfter:  entry.NotAfter,
+			Revoked:   entry.Revoked,
+		})
+	}
+	return s, nil
+}
+
+// ResolveTrustStore loads the trust store from path, falling back to the
+// VANMOOF_TRUST_STORE env var and then p.TrustStore().
+// Only the built-in keys are used when no file is configured or present.
+func ResolveTrustStore(path string, p Paths) (*TrustStore, error) {
+	if path == "" {
+		path = os.Getenv("VANMOOF_TRUST_STORE")
+	}
+	if path != "" {
+		return LoadTrustStore(path)
+	}
+
+	s, err := LoadTrustStore(p.TrustStore())
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultTrustStore(), nil
+	}
+	return s, err
+}
@@ -0,0 +1,136 @@
+package vanmoof
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTrustStore writes a trust store file with content to dir
+func writeTrustStore(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, trustStoreFile)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTrustStore(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	builtIn := knownCAKeys[0].keyHex
+	path := writeTrustStore(t, t.TempDir(), `{"keys": [
+		{"label": "Test CA", "public_key": "`+hex.EncodeToString(ca.PublicKey())+`", "not_after": "2027-01-01T00:00:00Z"},
+		{"label": "Other CA", "public_key": "`+base64.StdEncoding.EncodeToString(other.PublicKey())+`"},
+		{"label": "Revoked built-in", "public_key": "`+builtIn+`", "revoked": true}
+	]}`)
+
+	s, err := LoadTrustStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.CAs) != 3 {
+		t.Fatalf("%d CAs, want the built-in key replaced and 2 added: %v", len(s.CAs), s.CAs)
+	}
+	if s.CAs[0].Label != "Revoked built-in" || !s.CAs[0].Revoked || hex.EncodeToString(s.CAs[0].PublicKey) != builtIn {
+		t.Errorf("built-in key = %+v, want it revoked", s.CAs[0])
+	}
+	if !s.CAs[1].PublicKey.Equal(ca.PublicKey()) || !s.CAs[1].NotAfter.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("hex key = %+v", s.CAs[1])
+	}
+	if !s.CAs[2].PublicKey.Equal(other.PublicKey()) || s.CAs[2].Label != "Other CA" {
+		t.Errorf("base64 key = %+v", s.CAs[2])
+	}
+
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{"malformed JSON", `{"keys": [`, "invalid trust store"},
+		{"neither hex nor base64", `{"keys": [{"public_key": "not a key!"}]}`, "key 1: CA public key is neither hex nor base64"},
+		{"short hex key", `{"keys": [{"public_key": "` + builtIn + `"}, {"public_key": "` + builtIn[:62] + `"}]}`, "key 2: CA public key is neither hex nor base64"},
+		{"short base64 key", `{"keys": [{"public_key": "` + base64.StdEncoding.EncodeToString(make([]byte, 16)) + `"}]}`, "CA public key must be 32 bytes, got 16"},
+	} {
+		_, err := LoadTrustStore(writeTrustStore(t, t.TempDir(), tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	if _, err := LoadTrustStore(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestResolveTrustStore(t *testing.T) {
+	p := Paths{ConfigDir: t.TempDir()}
+	label := func(name string) string {
+		return `{"keys": [{"label": "` + name + `", "public_key": "` + hex.EncodeToString(newTestCA(t).PublicKey()) + `"}]}`
+	}
+	flagPath := writeTrustStore(t, t.TempDir(), label("flag"))
+	envPath := writeTrustStore(t, t.TempDir(), label("env"))
+
+	resolve := func(path string) string {
+		t.Helper()
+		s, err := ResolveTrustStore(path, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.CAs[len(s.CAs)-1].Label
+	}
+
+	// Only the built-in keys without a file
+	t.Setenv("VANMOOF_TRUST_STORE", "")
+	if got, want := resolve(""), knownCAKeys[0].label; got != want {
+		t.Errorf("no file: %q, want %q", got, want)
+	}
+	writeTrustStore(t, p.ConfigDir, label("default"))
+	if got := resolve(""); got != "default" {
+		t.Errorf("default path: %q", got)
+	}
+	t.Setenv("VANMOOF_TRUST_STORE", envPath)
+	if got := resolve(""); got != "env" {
+		t.Errorf("VANMOOF_TRUST_STORE before the default path: %q", got)
+	}
+	if got := resolve(flagPath); got != "flag" {
+		t.Errorf("flag before VANMOOF_TRUST_STORE: %q", got)
+	}
+
+	// A configured file must exist
+	if _, err := ResolveTrustStore(filepath.Join(t.TempDir(), "missing.json"), p); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing configured file: %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestVerifyShortCAKey(t *testing.T) {
+	ca := newTestCA(t)
+	store := ca.TrustStore()
+	store.CAs = append([]TrustedCA{{Label: "Truncated", PublicKey: ca.PublicKey()[:16]}}, store.CAs...)
+
+	report := issueAndVerify(t, ca, testPayload(), VerifyOptions{TrustStore: store})
+	if !report.SignatureVerified || !report.Valid() {
+		t.Errorf("verified %v, errors %q; want the short key skipped", report.SignatureVerified, report.Errors)
+	}
+
+	store.CAs = store.CAs[:1]
+	report = issueAndVerify(t, ca, testPayload(), VerifyOptions{TrustStore: store})
+	if report.SignatureVerified || !hasMessage(report.Errors, "Signature INVALID") {
+		t.Errorf("only the short key: verified %v, errors %q", report.SignatureVerified, report.Errors)
+	}
+
+	// The debug output skips the key too
+	raw, err := ca.Issue(testPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateCertificateSignature(cert.Signature, cert.Payload, store, testNow, true)
+}
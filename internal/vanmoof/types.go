@@ -1,6 +1,9 @@
 package vanmoof
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // API response types
 type AuthResponse struct {
@@ -73,40 +76,82 @@ type CertificateRequest struct {
 }
 
 type CertificateResponse struct {
-	Certificate string `json:"certificate"`
+	Certificate string          `json:"certificate"`
+	Err         json.RawMessage `json:"err,omitempty"` // Set instead of Certificate on failure
 }
 
-// CertificatePayload represents the CBOR-encoded certificate structure
+// CertificatePayload represents the CBOR-encoded certificate structure.
+// Field order matches the order VanMoof encodes the map in.
 type CertificatePayload struct {
-	ID        uint32                 `cbor:"i"`  // Bike API ID
-	FrameID   []byte                 `cbor:"f"` // Frame module serial (byte string)
-	BikeID    []byte                 `cbor:"b"` // Bike module serial (byte string)
-	Expiry    uint32                 `cbor:"e"`  // Expiry timestamp
-	Role      uint8                  `cbor:"r"`  // Access level/role
-	UserID    []byte                 `cbor:"u"`  // User ID (16 bytes)
-	PublicKey []byte                 `cbor:"p"`  // Public key (32 bytes)
-	Extra     map[string]interface{} `cbor:",inline"`
-}
-
-// certResult collects all parsed certificate data and validation outcomes
-type certResult struct {
-	// Parsed data
-	signature []byte
-	apiID     uint32
-	frameID   []byte
-	bikeID    []byte
-	expiry    uint32
-	role      uint8
-	userID    []byte
-	publicKey []byte
+	ID        uint32 `cbor:"i"` // Bike API ID
+	FrameID   string `cbor:"f"` // Frame module serial (text string)
+	BikeID    string `cbor:"b"` // Bike module serial (text string)
+	Expiry    uint32 `cbor:"e"` // Expiry timestamp
+	Role      uint8  `cbor:"r"` // Access level/role
+	UserID    []byte `cbor:"u"` // User ID (16 bytes)
+	PublicKey []byte `cbor:"p"` // Public key (32 bytes)
+}
+
+// Certificate is a parsed VanMoof bike certificate
+type Certificate struct {
+	Raw       []byte // Full certificate: signature followed by CBOR payload
+	Signature []byte // Ed25519 signature over Payload (64 bytes)
+	Payload   []byte // CBOR-encoded payload
+
+	ID        uint32 // Bike API ID (i)
+	FrameID   string // Frame module serial, AFM (f)
+	BikeID    string // Bike module serial, ABM (b)
+	Expiry    uint32 // Expiry timestamp (e)
+	Role      uint8  // Access level/role (r)
+	UserID    []byte // User ID (u, 16 bytes)
+	PublicKey []byte // Public key (p, 32 bytes)
+
+	// Missing or mistyped fields found while decoding; reported by Verify
+	fieldErrors []string
+}
+
+// VerifyOptions holds the optional expectations a certificate is checked against
+type VerifyOptions struct {
+	PublicKey string     // Expected base64 public key
+	BikeID    string     // Expected bike API ID or frame number
+	UserID    string     // Expected user UUID (hyphens optional)
+	Bikes     []BikeData // Account bikes to match the certificate against
+
+	// CAs the signature must verify against; nil uses DefaultTrustStore()
+	TrustStore *TrustStore
+	// Reference time for expiry and CA validity checks; zero means time.Now()
+	Now time.Time
+}
+
+// VerifyReport collects all validation outcomes for a certificate
+type VerifyReport struct {
+	Certificate *Certificate `json:"certificate"`
 
 	// Validation
-	errors   []string
-	warnings []string
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+	Expired  bool     `json:"expired"` // One of Errors is the expiry
 
 	// Match results
-	matchedBike    *BikeData
-	bikeIDVerified bool
-	pubKeyVerified bool
-	userIDVerified bool
+	MatchedBike       *BikeData  `json:"matched_bike,omitempty"`
+	BikeIDVerified    bool       `json:"bike_id_verified"`
+	PubKeyVerified    bool       `json:"public_key_verified"`
+	UserIDVerified    bool       `json:"user_id_verified"`
+	SignatureVerified bool       `json:"signature_verified"`
+	SignedBy          *TrustedCA `json:"signed_by,omitempty"` // CA whose key verified the signature, if any
+}
+
+// IssuedCertificate is the outcome of a certificate request for one bike
+type IssuedCertificate struct {
+	Bike        BikeData      `json:"bike"`
+	Model       string        `json:"model"`
+	Certificate string        `json:"certificate,omitempty"` // Base64 certificate
+	PublicKey   string        `json:"public_key"`
+	PrivateKey  string        `json:"private_key,omitempty"` // Only set when the key pair was generated
+	Report      *VerifyReport `json:"report,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Err         error         `json:"-"` // Typed cause of Error, for errors.Is/As
+
+	// Raw API response, echoed in text output
+	rawResponse string
 }
@@ -6,9 +6,11 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/mail"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -99,100 +101,111 @@ func ValidateFrameNumber(frameNumber string) bool {
 	return matched
 }
 
-func validateAndShowJWT(tokenString string) {
-	fmt.Println("\n[DEBUG] JWT Token Analysis:")
-
-	// Parse without validation first to inspect the token
-	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
-	token, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
-
+// validateAndShowJWT logs the header, claims and signature prefix of a JWT
+func validateAndShowJWT(log *slog.Logger, tokenString string) {
+	token, err := parseJWT(tokenString)
 	if err != nil {
-		fmt.Printf("[DEBUG] Failed to parse JWT: %v\n", err)
+		log.Debug("Failed to parse JWT", "error", err)
 		return
 	}
 
-	// Show header
-	if headerJSON, err := json.MarshalIndent(token.Header, "[DEBUG]   ", "  "); err == nil {
-		fmt.Printf("[DEBUG] JWT Header:\n%s\n", string(headerJSON))
+	var attrs []any
+	if headerJSON, err := json.Marshal(token.Header); err == nil {
+		attrs = append(attrs, "header", string(headerJSON))
 	}
-
-	// Show claims/payload
 	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		if claimsJSON, err := json.MarshalIndent(claims, "[DEBUG]   ", "  "); err == nil {
-			fmt.Printf("[DEBUG] JWT Payload:\n%s\n", string(claimsJSON))
+		if claimsJSON, err := json.Marshal(claims); err == nil {
+			attrs = append(attrs, "claims", string(claimsJSON))
 		}
 	}
-
-	// Show signature info
-	parts := strings.Split(tokenString, ".")
-	if len(parts) == 3 {
-		fmt.Printf("[DEBUG] JWT Signature (base64): %s...\n", parts[2][:min(40, len(parts[2]))])
+	if parts := strings.Split(tokenString, "."); len(parts) == 3 {
+		attrs = append(attrs, "signature_prefix", parts[2][:min(40, len(parts[2]))])
 	}
+	log.Debug("JWT token analysis", attrs...)
+}
 
-	fmt.Println()
+// parseJWT parses a JWT without verifying its signature or claims, to inspect it
+func parseJWT(tokenString string) (*jwt.Token, error) {
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	token, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
+	return token, err
 }
 
 // knownCAKeys are VanMoof's certificate signing (CA) public keys.
 // Format: hex-encoded 32-byte Ed25519 public key.
-var knownCAKeys = []string{
+var knownCAKeys = []struct{ label, keyHex string }{
 	// BLE certificate signing key recovered from the bike; verifies the
 	// Ed25519 signature embedded in every certificate.
-	"29b1f31c07d1c63b124057ebe75a0bc0796259722e5dd9a9a9302ae2061184a0",
+	{"VanMoof BLE certificate CA", "29b1f31c07d1c63b124057ebe75a0bc0796259722e5dd9a9a9302ae2061184a0"},
 }
 
-// verifyCertificateSignature reports whether the signature verifies against any
-// known CA key. hasKeys is false when no CA keys are configured.
-func verifyCertificateSignature(signature, payload []byte) (verified, hasKeys bool) {
-	if len(knownCAKeys) == 0 {
-		return false, false
+// ParseCAPublicKey decodes a CA public key given as hex (as in knownCAKeys) or base64
+func ParseCAPublicKey(s string) (ed25519.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if decoded, err := hex.DecodeString(s); err == nil && len(decoded) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(decoded), nil
 	}
-	for _, keyHex := range knownCAKeys {
-		pubKeyBytes, err := hex.DecodeString(keyHex)
-		if err != nil || len(pubKeyBytes) != ed25519.PublicKeySize {
-			continue
-		}
-		if ed25519.Verify(ed25519.PublicKey(pubKeyBytes), payload, signature) {
-			return true, true
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("CA public key is neither hex nor base64")
+	}
+	if len(decoded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("CA public key must be %d bytes, got %d", ed25519.PublicKeySize, len(decoded))
+	}
+	return ed25519.PublicKey(decoded), nil
+}
+
+// verifyCertificateSignature returns the CA whose key verifies the signature,
+// regardless of its revocation or validity window. hasKeys is false when the
+// trust store is empty.
+func verifyCertificateSignature(signature, payload []byte, store *TrustStore) (signer *TrustedCA, hasKeys bool) {
+	if len(store.CAs) == 0 {
+		return nil, false
+	}
+	for i := range store.CAs {
+		if store.CAs[i].verify(payload, signature) {
+			return &store.CAs[i], true
 		}
 	}
-	return false, true
+	return nil, true
 }
 
 // validateCertificateSignature prints detailed signature validation (debug mode)
-func validateCertificateSignature(signature, payload []byte, debug bool) {
+func validateCertificateSignature(signature, payload []byte, store *TrustStore, at time.Time, debug bool) {
 	if !debug {
 		return // Only show in debug mode
 	}
 
 	fmt.Println("\n[DEBUG] Signature Validation:")
 
-	if len(knownCAKeys) == 0 {
+	if len(store.CAs) == 0 {
 		fmt.Println("  ⚠ No VanMoof CA public keys available for validation")
 		fmt.Println("  The signature appears to be a valid Ed25519 signature (64 bytes)")
 		fmt.Println("  To validate, we would need VanMoof's Certificate Authority public key")
 		return
 	}
 
-	// Try each known CA public key
+	// Try each trusted CA public key
 	validated := false
-	for i, keyHex := range knownCAKeys {
-		pubKeyBytes, err := hex.DecodeString(keyHex)
-		if err != nil || len(pubKeyBytes) != ed25519.PublicKeySize {
-			fmt.Printf("  ✗ CA key %d: Invalid format\n", i+1)
+	for i := range store.CAs {
+		ca := &store.CAs[i]
+		if len(ca.PublicKey) != ed25519.PublicKeySize {
+			fmt.Printf("  ⚠ CA key %d has %d bytes instead of %d, skipped\n", i+1, len(ca.PublicKey), ed25519.PublicKeySize)
 			continue
 		}
-
-		pubKey := ed25519.PublicKey(pubKeyBytes)
-		if ed25519.Verify(pubKey, payload, signature) {
-			fmt.Printf("  ✓ Signature VALID with CA key %d\n", i+1)
-			fmt.Printf("    CA Public Key: %x\n", pubKeyBytes)
+		if ca.verify(payload, signature) {
+			fmt.Printf("  ✓ Signature VALID with CA key %d: %s\n", i+1, ca)
+			fmt.Printf("    CA Public Key: %x\n", []byte(ca.PublicKey))
+			if err := ca.checkValidity(at); err != nil {
+				fmt.Printf("    ✗ %v\n", err)
+			}
 			validated = true
 			break
 		}
 	}
 
-	if !validated && len(knownCAKeys) > 0 {
-		fmt.Println("  ✗ Signature validation failed with all known CA keys")
+	if !validated {
+		fmt.Printf("  ✗ Signature validation failed with all %d trusted CA keys\n", len(store.CAs))
 	}
 }
 
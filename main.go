@@ -1,118 +1,458 @@
 package main
 
 import (
-	"bufio"
+	"cmp"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"runtime"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"vanmoof-certificates/internal/vanmoof"
 )
 
+// command is a CLI subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"issue", "Request certificates for your bikes from the VanMoof API", runIssue},
+	{"parse", "Parse and verify a certificate", runParse},
+	{"keys", "Generate Ed25519 key pairs", runKeys},
+	{"bikes", "List the bikes on your account", runBikes},
+	{"cache", "Inspect the token cache", runCache},
+	{"mint", "Issue certificates signed by a local test CA", runMint},
+	{"fakeapi", "Serve a fake VanMoof API for offline development", runFakeAPI},
+	{"version", "Print version information", runVersion},
+	{"completion", "Print shell completion scripts", runCompletion},
+}
+
 func main() {
-	version := flag.Bool("version", false, "Print version information")
-	genkey := flag.Bool("genkey", false, "Generate Ed25519 key pair and exit")
-	cert := flag.String("cert", "", "Base64 encoded certificate string")
-	pubkey := flag.String("pubkey", "", "Base64 encoded public key string (optional)")
-	bikeid := flag.String("bikeid", "", "Bike ID to verify (optional)")
-	email := flag.String("email", "", "VanMoof email address (optional)")
-	bikes := flag.String("bikes", "all", "Bikes to fetch certificates for: 'all', bike IDs (comma-separated), or 'ask' to be prompted")
-	debug := flag.Bool("debug", false, "Enable debug output")
-	noCache := flag.Bool("no-cache", false, "Do not read or write token cache")
-	sudo := flag.Bool("sudo", false, "Skip all validation checks")
-	flag.Parse()
-
-	if *debug {
-		fmt.Printf("[DEBUG] Flags: version=%v, genkey=%v, cert='%s', pubkey='%s', bikeid='%s', email='%s', bikes='%s', sudo=%v\n", *version, *genkey, *cert, *pubkey, *bikeid, *email, *bikes, *sudo)
-	}
-
-	if *version {
-		fmt.Println("vanmoof-certificates version", vanmoof.Version)
-		fmt.Printf("OS: %s, Arch: %s, Go: %s, CPUs: %d, Compiler: %s\n", runtime.GOOS, runtime.GOARCH, runtime.Version(), runtime.NumCPU(), runtime.Compiler)
-		return
-	}
+	args := os.Args[1:]
 
-	if genkey != nil && *genkey {
-		privKeyB64, pubKeyB64, err := vanmoof.GenerateED25519()
-		if err != nil {
-			fmt.Printf("Error generating key pair: %v\n", err)
-			os.Exit(1)
+	// Interrupts cancel the running command, which stops its API requests, saves
+	// the token cache and reports what was done. A second interrupt kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// Without a command (or with only flags) fall back to the deprecated flat flag set
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if paths, err := vanmoof.DefaultPaths(); err == nil {
+			migrateLegacyFiles(paths)
+		}
+		if err := runLegacy(ctx, args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitCode(err))
 		}
-		fmt.Printf("Privkey = %s\n", privKeyB64)
-		fmt.Printf("Pubkey = %s\n", pubKeyB64)
 		return
 	}
 
-	// Validate cert if provided
-	if *cert != "" {
-		if !*sudo && !vanmoof.IsValidBase64(*cert) {
-			fmt.Println("Error: Invalid base64 certificate string")
+	name := args[0]
+	if name == "help" {
+		usage()
+		return
+	}
+	if name == completeCommand {
+		complete(args[1:])
+		return
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(ctx, args[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitCode(err))
+			}
 			return
 		}
 	}
 
-	// Validate pubkey if provided
-	if *pubkey != "" {
-		if !*sudo && !vanmoof.IsValidEd25519PublicKey(*pubkey) {
-			fmt.Println("Error: Invalid Ed25519 public key. Must be base64-encoded 32 or 33 bytes")
-			return
+	fmt.Fprintf(os.Stderr, "Unknown command '%s'\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+// Exit codes, documented in USAGE.md. Flag parse errors exit with exitUsage
+// from the flag package.
+const (
+	exitOK                 = 0
+	exitError              = 1   // Any other error
+	exitUsage              = 2   // Invalid command, flag or argument
+	exitUnauthorized       = 3   // Wrong password or rejected tokens
+	exitRateLimited        = 4   // Rate limited by the API, after retries
+	exitPartialFailure     = 5   // Some of the selected bikes got no valid certificate
+	exitInvalidCertificate = 6   // The certificate cannot be decoded or does not verify
+	exitExpiredCertificate = 7   // The certificate is valid but expired
+	exitInterrupted        = 130 // Interrupted by SIGINT or SIGTERM
+)
+
+// exitCode returns the exit code for an error returned by a command
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, new(usageError)):
+		return exitUsage
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, vanmoof.ErrPartialFailure):
+		return exitPartialFailure
+	case errors.Is(err, vanmoof.ErrUnauthorized):
+		return exitUnauthorized
+	case errors.Is(err, vanmoof.ErrRateLimited):
+		return exitRateLimited
+	case errors.Is(err, vanmoof.ErrCertificateExpired):
+		return exitExpiredCertificate
+	case errors.Is(err, vanmoof.ErrInvalidCertificate):
+		return exitInvalidCertificate
+	default:
+		return exitError
+	}
+}
+
+// usageError is an invalid flag or argument, reported with exitUsage
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// usageErrorf formats a usageError
+func usageErrorf(format string, args ...any) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// usage prints the list of commands
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+// newFlagSet creates a flag set for a command with a usage message
+func newFlagSet(name, args, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n", os.Args[0], name, args, description)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(fs.Output(), "\nFlags:\n")
+			fs.PrintDefaults()
 		}
 	}
+	return fs
+}
 
-	// Validate bikeid if provided
-	if *bikeid != "" {
-		if !*sudo && !vanmoof.IsValidBikeID(*bikeid) {
-			fmt.Printf("Error: Invalid bike ID '%s'. Must be a numeric ID or valid frame number pattern\n", *bikeid)
-			return
+// logOptions are the logging flags
+type logOptions struct {
+	debug       bool
+	debugUnsafe bool
+	level       string
+	format      string
+	file        string
+}
+
+// addLogFlags registers the logging flags on fs
+func addLogFlags(fs *flag.FlagSet, o *logOptions) {
+	fs.BoolVar(&o.debug, "debug", false, "Enable debug logging, same as -log-level debug (tokens, credentials and emails are redacted)")
+	fs.BoolFunc("debug-unsafe", "Enable debug logging WITHOUT redacting secrets. Do not share the output", func(string) error {
+		o.debug = true
+		o.debugUnsafe = true
+		return nil
+	})
+	fs.StringVar(&o.level, "log-level", "warn", "Log level: 'debug', 'info', 'warn' or 'error'")
+	fs.StringVar(&o.format, "log-format", "text", "Log format: 'text' or 'json'")
+	fs.StringVar(&o.file, "log-file", "", "Append logs to this file instead of stderr")
+}
+
+// newLogger creates the logger described by the options and logs the flag
+// values of fs at debug level. Secrets are redacted unless debugUnsafe is set.
+func (o logOptions) newLogger(fs *flag.FlagSet) (*slog.Logger, error) {
+	var level slog.Level
+	if o.debug {
+		level = slog.LevelDebug
+	} else if o.level != "" {
+		if err := level.UnmarshalText([]byte(o.level)); err != nil {
+			return nil, usageErrorf("invalid log level '%s'. Must be 'debug', 'info', 'warn' or 'error'", o.level)
 		}
+	} else {
+		level = slog.LevelWarn
 	}
 
-	// Validate bikes parameter
-	if *bikes != "all" && *bikes != "ask" {
-		bikeIDs := strings.Split(*bikes, ",")
-		for _, id := range bikeIDs {
-			id = strings.TrimSpace(id)
-			if id == "" {
-				fmt.Println("Error: Empty bike ID in bikes list")
-				return
-			}
-			var numericID uint32
-			if _, err := fmt.Sscanf(id, "%d", &numericID); err != nil {
-				if !*sudo && !vanmoof.ValidateFrameNumber(id) {
-					fmt.Printf("Error: Invalid bike ID '%s' in bikes list. Must be a numeric ID or frame number\n", id)
-					return
-				}
-			}
+	var out io.Writer = os.Stderr
+	if o.file != "" {
+		// Left open until the process exits
+		f, err := os.OpenFile(o.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
 		}
+		out = f
 	}
 
-	if *cert == "" {
-		emailInput := *email
-		if emailInput == "" {
-			reader := bufio.NewReader(os.Stdin)
-			fmt.Print("Enter VanMoof email: ")
-			var err error
-			emailInput, err = reader.ReadString('\n')
-			if err != nil {
-				fmt.Printf("Error reading email: %v\n", err)
-				return
-			}
-			emailInput = strings.TrimSpace(emailInput)
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch o.format {
+	case "", "text":
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return nil, usageErrorf("invalid log format '%s'. Must be 'text' or 'json'", o.format)
+	}
+	if !o.debugUnsafe {
+		handler = vanmoof.NewRedactingHandler(handler)
+	}
+	logger := slog.New(handler)
+
+	var flags []any
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f.Name, f.Value.String())
+	})
+	logger.Debug("Flags", slog.Group("flags", flags...))
+	return logger, nil
+}
+
+// clientOptions are the flags shared by the commands that talk to the VanMoof API
+type clientOptions struct {
+	logOptions
+	configOptions
+	apiURL             string
+	bikeAPIURL         string
+	vehicleRegistryURL string
+	tokenStore         string
+	credentialHelper   string
+	noCache            bool
+	record             string
+	replay             string
+	retries            int
+	retryMaxTime       time.Duration
+}
+
+// addClientFlags registers the API client and logging flags on fs
+func addClientFlags(fs *flag.FlagSet, o *clientOptions) {
+	addLogFlags(fs, &o.logOptions)
+	addConfigFlags(fs, &o.configOptions)
+	addTokenStoreFlag(fs, &o.tokenStore)
+	addEndpointFlags(fs, o)
+	fs.StringVar(&o.credentialHelper, "credential-helper", "", "Program and arguments of a git-credential style helper asked for the password before prompting (default $VANMOOF_CREDENTIAL_HELPER)")
+	fs.BoolVar(&o.noCache, "no-cache", false, "Do not read or write token cache")
+	fs.StringVar(&o.record, "record", "", "Record API interactions, with secrets redacted, into this directory (implies -no-cache)")
+	fs.StringVar(&o.replay, "replay", "", "Replay API interactions recorded with -record instead of using the network (implies -no-cache)")
+}
+
+// addEndpointFlags registers the API endpoint and retry flags on fs
+func addEndpointFlags(fs *flag.FlagSet, o *clientOptions) {
+	fs.StringVar(&o.apiURL, "api-url", "", "VanMoof API base URL (default $VANMOOF_API_URL or the production API)")
+	fs.StringVar(&o.bikeAPIURL, "bike-api-url", "", "Bike API base URL (default $VANMOOF_BIKE_API_URL or the production API)")
+	fs.StringVar(&o.vehicleRegistryURL, "vehicle-registry-url", "", "Vehicle Registry API base URL (default $VANMOOF_VEHICLE_REGISTRY_URL or the production API)")
+	fs.IntVar(&o.retries, "retries", vanmoof.DefaultRetryPolicy().MaxAttempts-1, "Retries per request after rate limiting, server or network errors (0 disables retries)")
+	fs.DurationVar(&o.retryMaxTime, "retry-max-time", vanmoof.DefaultRetryPolicy().MaxElapsed, "Maximum time spent on one request including retries and rate limit waits")
+}
+
+// newClient returns an API client logging to logger. The endpoint flags,
+// or VANMOOF_API_URL, VANMOOF_BIKE_API_URL and VANMOOF_VEHICLE_REGISTRY_URL,
+// override the endpoints, e.g. to use the fakeapi command. Recording or
+// replaying a cassette disables the token cache so the login is part of it.
+func newClient(o *clientOptions, logger *slog.Logger) (*vanmoof.Client, error) {
+	client := vanmoof.NewClient()
+	for _, endpoint := range []struct {
+		url *string
+		opt string
+		env string
+	}{
+		{&client.APIBaseURL, o.apiURL, "VANMOOF_API_URL"},
+		{&client.BikeAPIBaseURL, o.bikeAPIURL, "VANMOOF_BIKE_API_URL"},
+		{&client.VehicleRegistryBaseURL, o.vehicleRegistryURL, "VANMOOF_VEHICLE_REGISTRY_URL"},
+	} {
+		if url := cmp.Or(endpoint.opt, os.Getenv(endpoint.env)); url != "" {
+			*endpoint.url = url
 		}
+	}
+	client.Logger = logger
+	client.DebugUnsafe = o.debugUnsafe
+	client.Retry.MaxAttempts = o.retries + 1
+	client.Retry.MaxElapsed = o.retryMaxTime
+	paths, err := o.paths()
+	if err != nil {
+		return nil, err
+	}
+	client.BikeCachePath = paths.BikeCache()
+	store, err := newTokenStore(o.tokenStore, paths, logger)
+	if err != nil {
+		return nil, err
+	}
+	client.TokenStore = store
 
-		if !*sudo && !vanmoof.IsValidEmail(emailInput) {
-			fmt.Printf("Error: Invalid email address '%s'\n", emailInput)
-			return
+	// Passwords come from the credential helper or ~/.netrc before prompting
+	helper := o.credentialHelper
+	if helper == "" {
+		helper = os.Getenv("VANMOOF_CREDENTIAL_HELPER")
+	}
+	if command := strings.Fields(helper); len(command) > 0 {
+		client.CredentialHelper = &vanmoof.CredentialHelper{Command: command}
+	}
+	if path, err := vanmoof.DefaultNetrcPath(); err == nil {
+		client.NetrcPath = path
+	}
+	switch {
+	case o.record != "" && o.replay != "":
+		return nil, usageErrorf("-record and -replay cannot be combined")
+	case o.record != "":
+		transport, err := vanmoof.NewRecordTransport(o.record, client.HTTPClient.Transport)
+		if err != nil {
+			return nil, err
+		}
+		client.HTTPClient.Transport = transport
+		o.noCache = true
+	case o.replay != "":
+		transport, err := vanmoof.NewReplayTransport(o.replay)
+		if err != nil {
+			return nil, err
+		}
+		client.HTTPClient.Transport = transport
+		// The recorded login accepts any password
+		client.Password = "replay"
+		o.noCache = true
+	}
+	return client, nil
+}
+
+// migrateLegacyFiles moves the files left in ~/.vanmoof-certificates by
+// earlier versions to their place in paths
+func migrateLegacyFiles(paths vanmoof.Paths) {
+	moved, err := vanmoof.MigrateLegacyFiles(paths)
+	for _, m := range moved {
+		fmt.Fprintf(os.Stderr, "Moved %s\n", m)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// addTokenStoreFlag registers the -token-store flag on fs
+func addTokenStoreFlag(fs *flag.FlagSet, spec *string) {
+	fs.StringVar(spec, "token-store", "", "Where to cache tokens: 'file', 'file:<path>', 'dir:<directory>' or 'command:<program> [args]' (default $VANMOOF_TOKEN_STORE, else 'file')")
+}
+
+// newTokenStore returns the token store described by a -token-store value,
+// or by VANMOOF_TOKEN_STORE if it is empty. The file store defaults to
+// paths.TokenCache(). File and directory stores are encrypted with
+// VANMOOF_CACHE_KEY if set.
+func newTokenStore(spec string, paths vanmoof.Paths, logger *slog.Logger) (vanmoof.TokenStore, error) {
+	if spec == "" {
+		spec = os.Getenv("VANMOOF_TOKEN_STORE")
+	}
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "file":
+		if arg == "" {
+			arg = paths.TokenCache()
+		}
+		return &vanmoof.FileTokenStore{Path: arg, Key: os.Getenv("VANMOOF_CACHE_KEY"), Logger: logger}, nil
+	case "dir":
+		if arg == "" {
+			return nil, usageErrorf("-token-store dir: requires a directory")
+		}
+		return &vanmoof.DirTokenStore{Dir: arg, Key: os.Getenv("VANMOOF_CACHE_KEY")}, nil
+	case "command":
+		command := strings.Fields(arg)
+		if len(command) == 0 {
+			return nil, usageErrorf("-token-store command: requires a program")
 		}
+		return &vanmoof.CommandTokenStore{Command: command}, nil
+	default:
+		return nil, usageErrorf("invalid -token-store '%s'. Must be 'file', 'dir:<directory>' or 'command:<program>'", spec)
+	}
+}
 
-		if err := vanmoof.GetCert(emailInput, *bikes, *pubkey, *debug, *noCache); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			return
+// replayEmail is used when replaying a cassette without -email, as recorded emails are redacted
+const replayEmail = "replay@example.com"
+
+// runLegacy implements the deprecated flat flag set by mapping it onto the commands
+func runLegacy(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	version := fs.Bool("version", false, "Print version information (deprecated: use 'version')")
+	genkey := fs.Bool("genkey", false, "Generate Ed25519 key pair and exit (deprecated: use 'keys generate')")
+	cert := fs.String("cert", "", "Base64 encoded certificate string (deprecated: use 'parse')")
+	pubkey := fs.String("pubkey", "", "Base64 encoded public key string (optional)")
+	bikeid := fs.String("bikeid", "", "Bike ID to verify (optional)")
+	ca := fs.String("ca", "", "CA public key (hex or base64) to verify the certificate signature against instead of the trust store (optional)")
+	trustStore := fs.String("trust-store", "", "Path to CA trust store file (default $VANMOOF_TRUST_STORE or truststore.json in the config directory)")
+	email := fs.String("email", "", "VanMoof email address (optional)")
+	bikes := fs.String("bikes", "all", "Bikes to fetch certificates for: 'all', bike IDs (comma-separated), or 'ask' to be prompted")
+	output := fs.String("output", "text", "Output format: 'text' or 'json' (one JSON object per line)")
+	debug := fs.Bool("debug", false, "Enable debug output")
+	noCache := fs.Bool("no-cache", false, "Do not read or write token cache")
+	sudo := fs.Bool("sudo", false, "Skip all validation checks")
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintf(os.Stderr, "\nDeprecated flags (without a command):\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	logger, err := logOptions{debug: *debug}.newLogger(fs)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *version:
+		deprecated("-version", "version")
+		return runVersion(ctx, nil)
+	case *genkey:
+		deprecated("-genkey", "keys generate")
+		return generateKeys("")
+	case *cert != "":
+		deprecated("-cert", "parse")
+		return parseCert(parseOptions{
+			cert:       *cert,
+			pubkey:     *pubkey,
+			bikeid:     *bikeid,
+			ca:         *ca,
+			trustStore: *trustStore,
+			output:     *output,
+			debug:      *debug,
+			sudo:       *sudo,
+		})
+	default:
+		if len(args) > 0 {
+			deprecated("flags without a command", "issue")
 		}
-		return
+		return issue(ctx, logger, issueOptions{
+			email:      *email,
+			bikes:      *bikes,
+			pubkey:     *pubkey,
+			ca:         *ca,
+			trustStore: *trustStore,
+			output:     *output,
+			sudo:       *sudo,
+			clientOptions: clientOptions{
+				logOptions:   logOptions{debug: *debug},
+				noCache:      *noCache,
+				retries:      vanmoof.DefaultRetryPolicy().MaxAttempts - 1,
+				retryMaxTime: vanmoof.DefaultRetryPolicy().MaxElapsed,
+			},
+		})
 	}
+}
 
-	vanmoof.ProcessCertificate(*cert, *pubkey, *bikeid, "", nil, *debug)
+// deprecated prints a notice pointing to the replacement command
+func deprecated(old, replacement string) {
+	fmt.Fprintf(os.Stderr, "Note: %s is deprecated, use '%s %s' instead\n", old, os.Args[0], replacement)
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"vanmoof-certificates/internal/fakeapi"
+	"vanmoof-certificates/internal/vanmoof"
+)
+
+// isolateEnv points HOME at a temporary directory and clears the environment
+// variables that would make a command use the files or settings of the user
+func isolateEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range []string{
+		"VANMOOF_HOME", "VANMOOF_CONFIG", "VANMOOF_PROFILE", "VANMOOF_CACHE_KEY", "VANMOOF_TOKEN_STORE",
+		"VANMOOF_TRUST_STORE", "VANMOOF_CREDENTIAL_HELPER", "VANMOOF_PASSWORD",
+		"VANMOOF_API_URL", "VANMOOF_BIKE_API_URL", "VANMOOF_VEHICLE_REGISTRY_URL",
+		"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_STATE_HOME",
+	} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("HOME", t.TempDir())
+}
+
+// startFakeAPI serves a fake API with the demo account of email
+func startFakeAPI(t *testing.T, email, password string) (*fakeapi.Server, *vanmoof.TestCA, string) {
+	t.Helper()
+	ca, err := vanmoof.NewTestCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := fakeapi.New(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddAccount(fakeapi.DemoAccount(email, password))
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return server, ca, ts.URL
+}
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func() error) ([]byte, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.Bytes()
+	}()
+	err = fn()
+	w.Close()
+	return <-done, err
+}
+
+func TestExitCode(t *testing.T) {
+	apiError := func(status int) error {
+		return &vanmoof.APIError{StatusCode: status, Endpoint: "POST /v8/authenticate"}
+	}
+	for _, tc := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"error", errors.New("network down"), 1},
+		{"usage", usageErrorf("invalid output format 'yaml'"), 2},
+		{"usage wrapping a certificate error", usageErrorf("bad flag: %w", vanmoof.ErrInvalidCertificate), 2},
+		{"unauthorized", fmt.Errorf("authentication failed: %w", apiError(401)), 3},
+		{"rate limited", fmt.Errorf("authentication failed: %w", apiError(429)), 4},
+		{"server error", apiError(500), 1},
+		{"partial failure", fmt.Errorf("1 of 2 certificates failed: %w", vanmoof.ErrPartialFailure), 5},
+		{"partial failure with an unauthorized bike", fmt.Errorf("%w: %w", vanmoof.ErrPartialFailure, apiError(401)), 5},
+		{"invalid certificate", fmt.Errorf("%w: signature invalid", vanmoof.ErrInvalidCertificate), 6},
+		{"expired certificate", fmt.Errorf("%w: expired", vanmoof.ErrCertificateExpired), 7},
+		{"interrupted", fmt.Errorf("fetching bikes: %w", context.Canceled), 130},
+		{"interrupted while issuing", fmt.Errorf("%w: %w", vanmoof.ErrPartialFailure, context.Canceled), 130},
+	} {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	isolateEnv(t)
+	_, _, url := startFakeAPI(t, "rider@example.com", "password")
+	t.Setenv("VANMOOF_PASSWORD", "wrong")
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		run  func(context.Context, []string) error
+		args []string
+		want int
+	}{
+		{"issue -output yaml", runIssue, []string{"-output", "yaml"}, exitUsage},
+		{"bikes -output yaml", runBikes, []string{"-output", "yaml"}, exitUsage},
+		{"cache status -output yaml", runCache, []string{"status", "-output", "yaml"}, exitUsage},
+		{"parse garbage", runParse, []string{"not base64!"}, exitInvalidCertificate},
+		{"bikes with the wrong password", runBikes, []string{"-email", "rider@example.com", "-no-cache", "-retries", "0",
+			"-api-url", url + "/v8", "-bike-api-url", url, "-vehicle-registry-url", url}, exitUnauthorized},
+	} {
+		if got := exitCode(tc.run(ctx, tc.args)); got != tc.want {
+			t.Errorf("%s: exit code %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}